@@ -1,13 +1,25 @@
 package main
 
 import (
+	"expvar"
+	"fmt"
+	"imi/college/internal/dictionaries"
 	"imi/college/internal/env"
+	"imi/college/internal/erasure"
+	"imi/college/internal/export"
 	"imi/college/internal/handlers"
 	"imi/college/internal/httpx"
 	mw "imi/college/internal/middleware"
-	"imi/college/internal/models"
+	"imi/college/internal/migrations"
+	"imi/college/internal/permissions"
+	"imi/college/internal/roles"
+	"imi/college/internal/sessions"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
 	"github.com/go-chi/cors"
 
@@ -28,7 +40,58 @@ func main() {
 		log.Fatalln("Couldn't connect to postgres database")
 	}
 
-	models.AutoMigrate(db)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			migrate(db, os.Args[2:])
+			return
+		case "seed":
+			changed, err := dictionaries.Seed(db, true)
+			if err != nil {
+				log.Fatalf("Couldn't seed dictionaries: %v", err)
+			}
+			log.Printf("Seeded dictionaries, %d entries changed\n", changed)
+			return
+		case "import-settlements":
+			importSettlements(db, os.Args[2:])
+			return
+		default:
+			log.Fatalf("Unknown command %q, expected migrate, seed or import-settlements", os.Args[1])
+		}
+	}
+
+	if env.MigrateOnStart() {
+		applied, err := migrations.Up(db)
+		if err != nil {
+			log.Fatalf("Couldn't migrate the database: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %d_%s\n", m.Version, m.Name)
+		}
+	}
+
+	if env.SeedOnStart() {
+		if _, err := dictionaries.Seed(db, false); err != nil {
+			log.Fatalf("Couldn't seed dictionaries: %v", err)
+		}
+	}
+
+	if err := roles.EnsureDefaults(db); err != nil {
+		log.Fatalf("Couldn't create default roles: %v", err)
+	}
+
+	signer, err := sessions.NewSignerFromEnv(db)
+	if err != nil {
+		log.Fatalf("Couldn't set up signed tokens: %v", err)
+	}
+
+	if signer != nil {
+		signer.Watch(db, 30*time.Second)
+	}
+
+	erasure.New(db, signer).Watch(time.Hour)
+	exporter := export.NewExporter(db, env.ExportTTL())
+	exporter.Watch(time.Hour)
 
 	r := chi.NewRouter()
 	r.Use(chimw.Logger)
@@ -42,16 +105,25 @@ func main() {
 		MaxAge:           300,
 	}))
 
-	h := handlers.Create(db)
+	h := handlers.Create(db, signer, exporter)
 
 	// Public routes group
 	r.Group(func(r chi.Router) {
 		r.Post("/users", httpx.APIHandler(h.Users.Create))
 		r.Post("/tokens", httpx.APIHandler(h.Tokens.Create))
+		r.Post("/tokens/refresh", httpx.APIHandler(h.Tokens.Refresh))
 		r.Delete("/tokens", httpx.APIHandler(h.Tokens.Delete))
 
+		r.Get("/consents", httpx.APIHandler(h.Consents.ReadVersions))
+		r.Get("/consents/current", httpx.APIHandler(h.Consents.ReadCurrent))
+
+		r.Get("/majors", httpx.APIHandler(h.Dictionaries.ReadCatalogue))
+		r.Get("/majors/{majorId}", httpx.APIHandler(h.Dictionaries.ReadMajor))
+
 		r.Route("/dictionaries", func(r chi.Router) {
+			r.Get("/", httpx.APIHandler(h.Dictionaries.ReadAll))
 			r.Get("/regions", httpx.APIHandler(h.Dictionaries.ReadRegions))
+			r.Get("/regions/{regionId}/towns", httpx.APIHandler(h.Dictionaries.ReadTowns))
 			r.Get("/towntypes", httpx.APIHandler(h.Dictionaries.ReadTownTypes))
 			r.Get("/genders", httpx.APIHandler(h.Dictionaries.ReadGenders))
 			r.Get("/edulevels", httpx.APIHandler(h.Dictionaries.ReadEduLevels))
@@ -60,26 +132,79 @@ func main() {
 			r.Get("/iddoctypes", httpx.APIHandler(h.Dictionaries.ReadIdDocTypes))
 			r.Get("/edudoctypes", httpx.APIHandler(h.Dictionaries.ReadEduDocTypes))
 			r.Get("/nationalities", httpx.APIHandler(h.Dictionaries.ReadNationalities))
+
+			r.Group(func(r chi.Router) {
+				r.Use(mw.RequireUser(db, signer))
+
+				r.Post("/{dictionary}", httpx.APIHandler(h.Dictionaries.Create))
+				r.Put("/{dictionary}/{entryId}", httpx.APIHandler(h.Dictionaries.Update))
+				r.Delete("/{dictionary}/{entryId}", httpx.APIHandler(h.Dictionaries.Delete))
+				r.Post("/{dictionary}/{entryId}/retire", httpx.APIHandler(h.Dictionaries.Retire))
+				r.Post("/{dictionary}/{entryId}/restore", httpx.APIHandler(h.Dictionaries.Restore))
+
+				r.Get("/{dictionary}/{entryId}/translations", httpx.APIHandler(h.Dictionaries.ReadTranslations))
+				r.Put("/{dictionary}/{entryId}/translations/{locale}", httpx.APIHandler(h.Dictionaries.PutTranslation))
+				r.Delete("/{dictionary}/{entryId}/translations/{locale}", httpx.APIHandler(h.Dictionaries.DeleteTranslation))
+			})
 		})
 	})
 
 	// Authentication required
 	r.Group(func(r chi.Router) {
-		r.Use(mw.RequireUser(db))
+		r.Use(mw.RequireUser(db, signer))
+
+		r.With(mw.RequirePermissions(db, permissions.PermissionViewUser)).Get("/users", httpx.APIHandler(h.Users.Search))
 
 		r.Route("/users/{userId}", func(r chi.Router) {
 			r.Get("/", httpx.APIHandler(h.Users.Read))
+			r.With(mw.DenyImpersonated).Delete("/", httpx.APIHandler(h.Users.Delete))
 			r.Put("/details", httpx.APIHandler(h.Users.PutDetails))
 
 			r.Get("/address", httpx.APIHandler(h.Address.Read))
 			r.Put("/address", httpx.APIHandler(h.Address.CreateOrUpdate))
 
+			r.Get("/permissions", httpx.APIHandler(h.Users.ReadPermissions))
+			r.Get("/history", httpx.APIHandler(h.History.Read))
+			r.With(mw.DenyImpersonated).Get("/export", httpx.APIHandler(h.Export.Read))
+			r.With(mw.DenyImpersonated).Get("/export/{jobId}", httpx.APIHandler(h.Export.Download))
+
+			r.Route("/guardians", func(r chi.Router) {
+				r.Get("/", httpx.APIHandler(h.Guardians.Read))
+				r.With(mw.DenyImpersonated).Post("/", httpx.APIHandler(h.Guardians.Create))
+				r.With(mw.DenyImpersonated).Put("/{guardianId}", httpx.APIHandler(h.Guardians.Update))
+				r.With(mw.DenyImpersonated).Delete("/{guardianId}", httpx.APIHandler(h.Guardians.Delete))
+			})
+
+			r.Route("/consents", func(r chi.Router) {
+				r.Get("/", httpx.APIHandler(h.Consents.Read))
+				r.With(mw.DenyImpersonated).Post("/", httpx.APIHandler(h.Consents.Accept))
+				r.With(mw.DenyImpersonated).Post("/withdraw", httpx.APIHandler(h.Consents.Withdraw))
+			})
+
+			r.With(mw.DenyImpersonated, mw.RequirePermissions(db, permissions.PermissionAdmin)).Put("/permissions", httpx.APIHandler(h.Users.PutPermissions))
+			r.With(mw.DenyImpersonated, mw.RequirePermissions(db, permissions.PermissionAdmin)).Put("/roles", httpx.APIHandler(h.Roles.Assign))
+			r.With(mw.DenyImpersonated, mw.RequirePermissions(db, permissions.PermissionAdmin)).Post("/impersonate", httpx.APIHandler(h.Tokens.Impersonate))
+
+			r.Route("/scopes", func(r chi.Router) {
+				r.Use(mw.RequirePermissions(db, permissions.PermissionAdmin))
+
+				r.Get("/", httpx.APIHandler(h.Scopes.Read))
+				r.With(mw.DenyImpersonated).Put("/", httpx.APIHandler(h.Scopes.Put))
+			})
+
+			r.Route("/totp", func(r chi.Router) {
+				r.Get("/", httpx.APIHandler(h.TwoFactor.Read))
+				r.With(mw.DenyImpersonated).Post("/", httpx.APIHandler(h.TwoFactor.Enroll))
+				r.With(mw.DenyImpersonated).Delete("/", httpx.APIHandler(h.TwoFactor.Delete))
+				r.With(mw.DenyImpersonated).Post("/confirm", httpx.APIHandler(h.TwoFactor.Confirm))
+			})
+
 			r.Route("/applications", func(r chi.Router) {
 				r.Get("/", httpx.APIHandler(h.Applications.Read))
 				r.Post("/", httpx.APIHandler(h.Applications.Create))
 
 				r.Route("/{appId}", func(r chi.Router) {
-					r.Delete("/", httpx.APIHandler(h.Applications.Delete))
+					r.With(mw.DenyImpersonated).Delete("/", httpx.APIHandler(h.Applications.Delete))
 				})
 			})
 
@@ -93,6 +218,29 @@ func main() {
 		})
 
 		r.Post("/files", httpx.APIHandler(h.Files.CreateFile))
+
+		r.With(mw.RequirePermissions(db, permissions.PermissionAdmin)).Get("/audit", httpx.APIHandler(h.Audit.Read))
+		r.With(mw.RequirePermissions(db, permissions.PermissionAdmin)).Get("/retention", httpx.APIHandler(h.Consents.ReadRetention))
+
+		r.Route("/enrollment-orders", func(r chi.Router) {
+			r.Use(mw.RequirePermissions(db, permissions.PermissionEditApplications))
+
+			r.With(mw.DenyImpersonated).Post("/", httpx.APIHandler(h.Enrollment.Create))
+			r.Get("/{orderId}", httpx.APIHandler(h.Enrollment.Read))
+		})
+		r.With(mw.RequirePermissions(db, permissions.PermissionAdmin)).Post("/consents", httpx.APIHandler(h.Consents.CreateVersion))
+
+		// cache hit rates and other runtime metrics
+		r.With(mw.RequirePermissions(db, permissions.PermissionAdmin)).Get("/debug/vars", expvar.Handler().ServeHTTP)
+
+		r.Route("/roles", func(r chi.Router) {
+			r.Use(mw.RequirePermissions(db, permissions.PermissionAdmin))
+
+			r.Get("/", httpx.APIHandler(h.Roles.Read))
+			r.Post("/", httpx.APIHandler(h.Roles.Create))
+			r.Put("/{roleId}", httpx.APIHandler(h.Roles.Update))
+			r.Delete("/{roleId}", httpx.APIHandler(h.Roles.Delete))
+		})
 	})
 
 	srv := http.Server{
@@ -105,3 +253,82 @@ func main() {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// migrate up|down [steps]|status
+func migrate(db *gorm.DB, args []string) {
+	if len(args) == 0 {
+		log.Fatalln("Expected migrate up, down [steps] or status")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(db)
+		for _, m := range applied {
+			log.Printf("Applied migration %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Couldn't migrate the database: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Println("The database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				log.Fatalf("Invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+
+		reverted, err := migrations.Down(db, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Couldn't revert migrations: %v", err)
+		}
+	case "status":
+		statuses, err := migrations.GetStatus(db)
+		if err != nil {
+			log.Fatalf("Couldn't read migrations: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Unknown {
+				appliedAt += " (unknown to this build)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		w.Flush()
+	default:
+		log.Fatalf("Unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
+
+// import-settlements file.csv
+func importSettlements(db *gorm.DB, args []string) {
+	if len(args) != 1 {
+		log.Fatalln("Expected import-settlements followed by a path to a UTF-8 CSV dump")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		log.Fatalf("Couldn't open the dump: %v", err)
+	}
+	defer f.Close()
+
+	result, err := dictionaries.ImportSettlements(db, f)
+	if err != nil {
+		log.Fatalf("Couldn't import settlements: %v", err)
+	}
+
+	log.Printf("Imported %d settlements, skipped %d of unknown regions\n", result.Imported, result.Skipped)
+}
@@ -0,0 +1,253 @@
+package attempts
+
+import (
+	"sync"
+	"time"
+)
+
+// failed attempts made for a single key (username, ip and etc.)
+type Record struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// storage for attempt records, records are expected to be forgotten
+// once their ttl passes; the in-memory implementation is enough for
+// a single instance, multiple replicas need a shared one (e.g. redis)
+type Store interface {
+	Get(key string) (Record, bool, error)
+	// reads and writes the record of the key as a single step, so
+	// concurrent updates can't be lost; the record isn't written
+	// when fn returns false
+	Update(key string, fn func(record Record, found bool) (Record, time.Duration, bool)) error
+	Delete(key string) error
+}
+
+type Policy struct {
+	// failures allowed before any delay is enforced
+	FreeAttempts int
+	// delay after the first failure beyond free attempts,
+	// each subsequent failure doubles it
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// amount of failures after which the key gets locked
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// failures are forgotten after this much time without new ones
+	Window time.Duration
+}
+
+var UserPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// many applicants may share a single address (e.g. a school computer
+// class or a mobile carrier's NAT), so addresses get more leeway
+var IPPolicy = Policy{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    100,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+type Tracker struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewTracker(store Store, policy Policy) *Tracker {
+	return &Tracker{store: store, policy: policy, now: time.Now}
+}
+
+// reports how long the caller has to wait before the next attempt
+// for the key is allowed and whether the key is locked out
+func (t *Tracker) Wait(key string) (time.Duration, bool, error) {
+	record, ok, err := t.store.Get(key)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	wait, locked := t.wait(record, t.now())
+
+	return wait, locked, nil
+}
+
+// checks whether an attempt for the key is allowed and if it is, counts
+// it as failed right away, so concurrent attempts can't all get through
+// before any of them fails; successful attempts must be given back with
+// Forgive or Reset
+func (t *Tracker) Attempt(key string) (time.Duration, bool, error) {
+	var wait time.Duration
+	var locked bool
+
+	err := t.store.Update(key, func(record Record, _ bool) (Record, time.Duration, bool) {
+		now := t.now()
+
+		wait, locked = t.wait(record, now)
+		if wait > 0 {
+			return record, 0, false
+		}
+
+		record, ttl := t.fail(record, now)
+		return record, ttl, true
+	})
+
+	return wait, locked, err
+}
+
+// registers a failed attempt for the key
+func (t *Tracker) Fail(key string) error {
+	return t.store.Update(key, func(record Record, _ bool) (Record, time.Duration, bool) {
+		record, ttl := t.fail(record, t.now())
+		return record, ttl, true
+	})
+}
+
+// gives back an attempt counted by Attempt which didn't fail
+func (t *Tracker) Forgive(key string) error {
+	return t.store.Update(key, func(record Record, found bool) (Record, time.Duration, bool) {
+		if !found || record.Failures == 0 {
+			return record, 0, false
+		}
+
+		record.Failures--
+
+		// lockouts only start once failures reach the limit,
+		// so the given back attempt is the one which started it
+		if record.Failures < t.policy.LockoutAfter {
+			record.LockedUntil = time.Time{}
+		}
+
+		return record, t.policy.Window, true
+	})
+}
+
+// forgets all failures of the key
+func (t *Tracker) Reset(key string) error {
+	return t.store.Delete(key)
+}
+
+func (t *Tracker) wait(record Record, now time.Time) (time.Duration, bool) {
+	if now.Before(record.LockedUntil) {
+		return record.LockedUntil.Sub(now), true
+	}
+
+	wait := record.LastFailure.Add(t.delay(record.Failures)).Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, false
+}
+
+func (t *Tracker) fail(record Record, now time.Time) (Record, time.Duration) {
+	record.Failures++
+	record.LastFailure = now
+
+	ttl := t.policy.Window
+
+	if record.Failures >= t.policy.LockoutAfter {
+		record.LockedUntil = now.Add(t.policy.LockoutDuration)
+		ttl = max(ttl, t.policy.LockoutDuration)
+	}
+
+	return record, ttl
+}
+
+func (t *Tracker) delay(failures int) time.Duration {
+	over := failures - t.policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	delay := t.policy.BaseDelay
+	for i := 1; i < over && delay < t.policy.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, t.policy.MaxDelay)
+}
+
+type memoryEntry struct {
+	record    Record
+	expiresAt time.Time
+}
+
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	writes  int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *MemoryStore) Get(key string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.get(key)
+
+	return record, ok, nil
+}
+
+func (s *MemoryStore) Update(key string, fn func(record Record, found bool) (Record, time.Duration, bool)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ttl, ok := fn(s.get(key))
+	if ok {
+		s.set(key, record, ttl)
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) get(key string) (Record, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return Record{}, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return Record{}, false
+	}
+
+	return entry.record, true
+}
+
+func (s *MemoryStore) set(key string, record Record, ttl time.Duration) {
+	s.entries[key] = memoryEntry{record: record, expiresAt: time.Now().Add(ttl)}
+
+	// expired entries are only removed when read, so once in a while
+	// sweep the whole map to not keep keys which are never seen again
+	s.writes++
+	if s.writes%1024 == 0 {
+		now := time.Now()
+		for k, e := range s.entries {
+			if now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+	}
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
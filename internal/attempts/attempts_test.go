@@ -0,0 +1,136 @@
+package attempts
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestTracker(policy Policy) (*Tracker, *time.Time) {
+	moment := time.Date(2024, time.July, 25, 12, 0, 0, 0, time.UTC)
+
+	tracker := NewTracker(NewMemoryStore(), policy)
+	tracker.now = func() time.Time { return moment }
+
+	return tracker, &moment
+}
+
+func TestBackoffGrowsExponentially(t *testing.T) {
+	policy := Policy{
+		FreeAttempts:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutAfter:    100,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+
+	tracker, _ := newTestTracker(policy)
+
+	expected := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+
+	for i, want := range expected {
+		if err := tracker.Fail("alice"); err != nil {
+			t.Fatal(err)
+		}
+
+		wait, locked, err := tracker.Wait("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if locked {
+			t.Fatalf("key must not be locked after %d failures", i+1)
+		}
+
+		if wait != want {
+			t.Fatalf("unexpected wait after %d failures:\nactual: %v\nexpected: %v\n", i+1, wait, want)
+		}
+	}
+}
+
+func TestLockoutAndReset(t *testing.T) {
+	policy := Policy{
+		FreeAttempts:    1,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Second,
+		LockoutAfter:    3,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+
+	tracker, moment := newTestTracker(policy)
+
+	for range 3 {
+		if err := tracker.Fail("bob"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wait, locked, err := tracker.Wait("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !locked || wait != 15*time.Minute {
+		t.Fatalf("key must be locked for 15 minutes, got locked=%v wait=%v", locked, wait)
+	}
+
+	*moment = moment.Add(16 * time.Minute)
+
+	if _, locked, _ := tracker.Wait("bob"); locked {
+		t.Fatal("lockout must expire")
+	}
+
+	if err := tracker.Reset("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	wait, locked, err = tracker.Wait("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if locked || wait != 0 {
+		t.Fatal("reset key must not have any restrictions")
+	}
+}
+
+func TestAttemptIsCountedUntilForgiven(t *testing.T) {
+	policy := Policy{
+		FreeAttempts:    0,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Second,
+		LockoutAfter:    1,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+
+	tracker, _ := newTestTracker(policy)
+
+	if wait, _, err := tracker.Attempt("carol"); err != nil || wait != 0 {
+		t.Fatalf("first attempt must be allowed, got wait=%v err=%v", wait, err)
+	}
+
+	// the first attempt hasn't finished yet, so a concurrent one is refused
+	wait, locked, err := tracker.Attempt("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !locked || wait != time.Hour {
+		t.Fatalf("concurrent attempt must be refused, got locked=%v wait=%v", locked, wait)
+	}
+
+	if err := tracker.Forgive("carol"); err != nil {
+		t.Fatal(err)
+	}
+
+	wait, locked, err = tracker.Wait("carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if locked || wait != 0 {
+		t.Fatalf("forgiven attempt must not restrict the key, got locked=%v wait=%v", locked, wait)
+	}
+}
@@ -0,0 +1,26 @@
+package audit
+
+import (
+	"imi/college/internal/models"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ActionRead   = "read"
+	ActionModify = "modify"
+)
+
+func ActionFromMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ActionRead
+	default:
+		return ActionModify
+	}
+}
+
+func Record(db *gorm.DB, entry models.AuditEntry) error {
+	return db.Create(&entry).Error
+}
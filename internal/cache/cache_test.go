@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestCache(capacity int, ttl time.Duration) (*Memory[string, int], *time.Time) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	c := NewMemory[string, int](capacity, ttl)
+	c.now = func() time.Time { return now }
+
+	return c, &now
+}
+
+func TestMemoryGetSet(t *testing.T) {
+	c, _ := newTestCache(10, time.Minute)
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("empty cache returned a value")
+	}
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+
+	if value, ok := c.Get("a"); !ok || value != 2 {
+		t.Fatalf("Get(a) = %d, %v, want 2, true", value, ok)
+	}
+
+	c.Delete("a")
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("deleted entry returned")
+	}
+}
+
+func TestMemoryExpiration(t *testing.T) {
+	c, now := newTestCache(10, time.Minute)
+
+	c.Set("a", 1)
+
+	*now = now.Add(59 * time.Second)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("entry expired too early")
+	}
+
+	*now = now.Add(time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expired entry returned")
+	}
+
+	if size := c.Stats().Size; size != 0 {
+		t.Fatalf("expired entry kept, size %d", size)
+	}
+}
+
+func TestMemoryEviction(t *testing.T) {
+	c, _ := newTestCache(2, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	// a becomes the most recently used, so b is evicted
+	c.Get("a")
+	c.Set("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry wasn't evicted")
+	}
+
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+
+	if evictions := c.Stats().Evictions; evictions != 1 {
+		t.Errorf("evictions = %d, want 1", evictions)
+	}
+}
+
+func TestMemoryClear(t *testing.T) {
+	c, _ := newTestCache(10, time.Minute)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Clear()
+
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("entry survived Clear")
+	}
+
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("cache unusable after Clear")
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	c, _ := newTestCache(10, time.Minute)
+
+	c.Set("a", 1)
+	c.Get("a")
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+
+	stats := c.Stats()
+
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Size != 1 {
+		t.Fatalf("stats = %+v, want 3 hits, 1 miss and size 1", stats)
+	}
+
+	if stats.HitRate != 0.75 {
+		t.Fatalf("hit rate = %v, want 0.75", stats.HitRate)
+	}
+}
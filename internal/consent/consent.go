@@ -0,0 +1,139 @@
+package consent
+
+import (
+	"errors"
+	"imi/college/internal/models"
+	"imi/college/internal/types/date"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// applicants younger than that need consent of a parent
+const AdultAge = 18
+
+var (
+	ErrNoVersion      = errors.New("no consent version is in effect")
+	ErrMissing        = errors.New("consent is missing")
+	ErrOutdated       = errors.New("consent was given to an outdated version")
+	ErrParentRequired = errors.New("consent of a parent is required")
+)
+
+func IsMinor(birthday date.Date, now time.Time) bool {
+	return birthday.Age(now) < AdultAge
+}
+
+func CurrentVersion(db *gorm.DB) (models.ConsentVersion, error) {
+	var version models.ConsentVersion
+
+	err := db.
+		Where("effective_at <= ?", time.Now()).
+		Order("effective_at DESC, id DESC").
+		First(&version).
+		Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.ConsentVersion{}, ErrNoVersion
+	}
+
+	return version, err
+}
+
+// returns the latest consent of the user which hasn't been withdrawn
+func Active(db *gorm.DB, userID uuid.UUID) (models.Consent, error) {
+	var consent models.Consent
+
+	err := db.
+		Where(&models.Consent{UserID: userID}).
+		Where("withdrawn_at IS NULL").
+		Order("accepted_at DESC").
+		First(&consent).
+		Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Consent{}, ErrMissing
+	}
+
+	return consent, err
+}
+
+// makes sure the user has consented to the version in effect,
+// user's details must be loaded to tell whether they are a minor
+func Check(db *gorm.DB, user models.User) error {
+	version, err := CurrentVersion(db)
+	if err != nil {
+		return err
+	}
+
+	consent, err := Active(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if consent.VersionID != version.ID {
+		return ErrOutdated
+	}
+
+	if user.Details != nil && IsMinor(user.Details.Birthday, time.Now()) && consent.ParentName == nil {
+		return ErrParentRequired
+	}
+
+	return nil
+}
+
+// withdraws every consent of the user and schedules disposal of
+// their personal data, the returned request is the pending one
+// if the data is already scheduled to be disposed of
+func Withdraw(tx *gorm.DB, userID uuid.UUID, retention time.Duration) (models.RetentionRequest, error) {
+	now := time.Now()
+
+	err := tx.
+		Model(&models.Consent{}).
+		Where(&models.Consent{UserID: userID}).
+		Where("withdrawn_at IS NULL").
+		Update("withdrawn_at", now).
+		Error
+
+	if err != nil {
+		return models.RetentionRequest{}, err
+	}
+
+	var request models.RetentionRequest
+
+	err = tx.
+		Where(&models.RetentionRequest{UserID: &userID}).
+		Where("completed_at IS NULL AND cancelled_at IS NULL").
+		First(&request).
+		Error
+
+	if err == nil {
+		return request, nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.RetentionRequest{}, err
+	}
+
+	request = models.RetentionRequest{
+		UserID:    &userID,
+		CreatedAt: now,
+		DueAt:     now.Add(retention),
+	}
+
+	if err := tx.Create(&request).Error; err != nil {
+		return models.RetentionRequest{}, err
+	}
+
+	return request, nil
+}
+
+// consent given again stops pending disposal of the user's data
+func CancelRetention(tx *gorm.DB, userID uuid.UUID) error {
+	return tx.
+		Model(&models.RetentionRequest{}).
+		Where(&models.RetentionRequest{UserID: &userID}).
+		Where("completed_at IS NULL AND cancelled_at IS NULL").
+		Update("cancelled_at", time.Now()).
+		Error
+}
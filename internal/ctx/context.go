@@ -4,6 +4,8 @@ import (
 	"errors"
 	"imi/college/internal/models"
 	"net/http"
+
+	"github.com/google/uuid"
 )
 
 var ErrUserNotFound error = errors.New("user data is not attached to request context")
@@ -16,3 +18,17 @@ func GetCurrentUser(r *http.Request) (models.User, error) {
 
 	return user, nil
 }
+
+// users restored from signed tokens only have ID and permissions
+// filled in, the rest has to be loaded from the database
+func IsStatelessUser(r *http.Request) bool {
+	stateless, _ := r.Context().Value(StatelessKey).(bool)
+	return stateless
+}
+
+// returns the id of the staff member acting on behalf of
+// the current user, if the request is made by one
+func GetImpersonator(r *http.Request) (uuid.UUID, bool) {
+	id, ok := r.Context().Value(ImpersonatorKey).(uuid.UUID)
+	return id, ok
+}
@@ -3,3 +3,7 @@ package ctx
 type UserCtxKey string
 
 const UserKey UserCtxKey = UserCtxKey("User")
+
+const StatelessKey UserCtxKey = UserCtxKey("Stateless")
+
+const ImpersonatorKey UserCtxKey = UserCtxKey("Impersonator")
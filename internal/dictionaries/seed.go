@@ -0,0 +1,246 @@
+package dictionaries
+
+import (
+	"embed"
+	"encoding/csv"
+	"fmt"
+	"imi/college/internal/models"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//go:embed seeds/*.csv
+var seedFiles embed.FS
+
+type seed struct {
+	file  string
+	model any
+	// dictionary whose version is bumped on changes,
+	// empty for tables without versions
+	name string
+}
+
+var seeds = []seed{
+	{"towntypes.csv", &models.DictTownType{}, TownTypes},
+	{"regions.csv", &models.DictRegion{}, Regions},
+	{"genders.csv", &models.DictGender{}, Genders},
+	{"edulevels.csv", &models.DictEduLevel{}, EduLevels},
+	{"appstatuses.csv", &models.DictAppStatus{}, AppStatuses},
+	{"iddoctypes.csv", &models.DictIdDocType{}, IdDocTypes},
+	{"edudoctypes.csv", &models.DictEduDocType{}, EduDocTypes},
+	{"nationalities.csv", &models.DictNationality{}, Nationalities},
+	{"docstatuses.csv", &models.DocStatus{}, ""},
+}
+
+// converts a CSV field to the value of the column,
+// empty fields of unlisted columns are stored as NULL
+var seedColumns = map[string]func(string) (any, error){
+	"id":            parseSeedInt,
+	"region_id":     parseSeedInt,
+	"sort_priority": parseSeedInt,
+	"is_default": func(value string) (any, error) {
+		return strconv.ParseBool(value)
+	},
+}
+
+func parseSeedInt(value string) (any, error) {
+	return strconv.Atoi(value)
+}
+
+// once set, the default is up to admins and isn't overwritten
+var seedInsertOnly = map[string]bool{"id": true, "is_default": true}
+
+// reads the seed file, the header holds column names
+func readSeed(file string) ([]string, []map[string]any, error) {
+	f, err := seedFiles.Open("seeds/" + file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("seeds/%s: %w", file, err)
+	}
+
+	var rows []map[string]any
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("seeds/%s: %w", file, err)
+		}
+
+		row := make(map[string]any, len(header))
+
+		for i, column := range header {
+			value := strings.TrimSpace(record[i])
+
+			parse, ok := seedColumns[column]
+			switch {
+			case ok:
+				if row[column], err = parse(value); err != nil {
+					return nil, nil, fmt.Errorf("seeds/%s: line %d: %s: %w", file, len(rows)+2, column, err)
+				}
+			case len(value) == 0:
+				row[column] = nil
+			default:
+				row[column] = value
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return header, rows, nil
+}
+
+// inserts missing rows, with overwrite columns of existing rows are
+// brought back to the seeds as well; rows which already match are left
+// untouched so running it again changes nothing
+func upsertRows(tx *gorm.DB, model any, key []string, header []string, rows []map[string]any, overwrite bool) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	table := stmt.Schema.Table
+
+	keyColumns := make([]clause.Column, len(key))
+	for i, column := range key {
+		keyColumns[i] = clause.Column{Name: column}
+	}
+
+	var updated []string
+	var current, excluded []string
+
+	for _, column := range header {
+		if seedInsertOnly[column] || slices.Contains(key, column) {
+			continue
+		}
+		updated = append(updated, column)
+		current = append(current, fmt.Sprintf("%s.%s", table, column))
+		excluded = append(excluded, "excluded."+column)
+	}
+
+	conflict := clause.OnConflict{
+		Columns:   keyColumns,
+		DoUpdates: clause.AssignmentColumns(updated),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: fmt.Sprintf("(%s) IS DISTINCT FROM (%s)", strings.Join(current, ", "), strings.Join(excluded, ", "))},
+		}},
+	}
+
+	if len(updated) == 0 || !overwrite {
+		conflict = clause.OnConflict{Columns: keyColumns, DoNothing: true}
+	}
+
+	result := tx.Model(model).Clauses(conflict).Create(&rows)
+
+	return result.RowsAffected, result.Error
+}
+
+// dictionary versions are only bumped when entries have actually changed
+func upsertSeed(tx *gorm.DB, s seed, overwrite bool) (int64, error) {
+	header, rows, err := readSeed(s.file)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := upsertRows(tx, s.model, []string{"id"}, header, rows, overwrite)
+	if err != nil {
+		return 0, fmt.Errorf("seeds/%s: %w", s.file, err)
+	}
+
+	if affected > 0 && len(s.name) > 0 {
+		if err := Bump(tx, s.name); err != nil {
+			return 0, err
+		}
+	}
+
+	return affected, nil
+}
+
+const translationsFile = "translations.csv"
+
+// translations are seeded per dictionary, so only versions
+// of dictionaries whose translations have changed are bumped
+func upsertTranslations(tx *gorm.DB, overwrite bool) (int64, error) {
+	header, rows, err := readSeed(translationsFile)
+	if err != nil {
+		return 0, err
+	}
+
+	var names []string
+	byName := make(map[string][]map[string]any)
+
+	for _, row := range rows {
+		name, _ := row["dictionary"].(string)
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], row)
+	}
+
+	var changed int64
+
+	for _, name := range names {
+		affected, err := upsertRows(tx, &models.DictTranslation{}, []string{"dictionary", "entry_id", "locale"}, header, byName[name], overwrite)
+		if err != nil {
+			return 0, fmt.Errorf("seeds/%s: %w", translationsFile, err)
+		}
+
+		if affected > 0 {
+			if err := Bump(tx, name); err != nil {
+				return 0, err
+			}
+		}
+
+		changed += affected
+	}
+
+	return changed, nil
+}
+
+// fills dictionaries with the embedded seeds, safe to run on every start;
+// entries edited by admins are only reset to the seeds with overwrite
+func Seed(db *gorm.DB, overwrite bool) (int64, error) {
+	var changed int64
+
+	txFn := func(tx *gorm.DB) error {
+		for _, s := range seeds {
+			affected, err := upsertSeed(tx, s, overwrite)
+			if err != nil {
+				return err
+			}
+			changed += affected
+		}
+
+		affected, err := upsertTranslations(tx, overwrite)
+		if err != nil {
+			return err
+		}
+		changed += affected
+
+		return nil
+	}
+
+	if err := db.Transaction(txFn); err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
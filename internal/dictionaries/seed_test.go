@@ -0,0 +1,93 @@
+package dictionaries
+
+import (
+	"testing"
+)
+
+func TestSeeds(t *testing.T) {
+	for _, s := range seeds {
+		header, rows, err := readSeed(s.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rows) == 0 {
+			t.Errorf("%s: no entries", s.file)
+		}
+
+		if header[0] != "id" {
+			t.Errorf("%s: first column is %q, want id", s.file, header[0])
+		}
+
+		ids := make(map[any]bool, len(rows))
+		defaults := 0
+
+		for _, row := range rows {
+			if ids[row["id"]] {
+				t.Errorf("%s: duplicate id %v", s.file, row["id"])
+			}
+			ids[row["id"]] = true
+
+			if row["value"] == nil {
+				t.Errorf("%s: entry %v has no value", s.file, row["id"])
+			}
+
+			if isDefault, ok := row["is_default"].(bool); ok && isDefault {
+				defaults++
+			}
+		}
+
+		if _, ok := rows[0]["is_default"]; ok && defaults != 1 {
+			t.Errorf("%s: %d default entries, want exactly one", s.file, defaults)
+		}
+	}
+}
+
+func TestTranslationSeeds(t *testing.T) {
+	entries := make(map[string]map[string]bool)
+
+	for _, s := range seeds {
+		if len(s.name) == 0 {
+			continue
+		}
+
+		_, rows, err := readSeed(s.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries[s.name] = make(map[string]bool, len(rows))
+		for _, row := range rows {
+			entries[s.name][EntryID(row["id"])] = true
+		}
+	}
+
+	_, rows, err := readSeed(translationsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range rows {
+		name, _ := row["dictionary"].(string)
+		entryID, _ := row["entry_id"].(string)
+		locale, _ := row["locale"].(string)
+
+		ids, ok := entries[name]
+		if !ok {
+			t.Errorf("translation of %s/%s: unknown dictionary", name, entryID)
+			continue
+		}
+
+		if !ids[entryID] {
+			t.Errorf("translation of %s/%s: unknown entry", name, entryID)
+		}
+
+		if !IsLocale(locale) || locale == DefaultLocale {
+			t.Errorf("translation of %s/%s: unexpected locale %q", name, entryID, locale)
+		}
+
+		if row["display_value"] == nil {
+			t.Errorf("translation of %s/%s: empty display value", name, entryID)
+		}
+	}
+}
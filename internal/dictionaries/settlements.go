@@ -0,0 +1,312 @@
+package dictionaries
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"imi/college/internal/models"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// settlement as read from a dump, before regions
+// and town types are resolved
+type settlementRecord struct {
+	Code       string
+	RegionCode int
+	Type       string
+	Name       string
+	PostCode   string
+}
+
+// header names of the columns in KLADR (KLADR.DBF) and FIAS (ADDROBJ) dumps
+var settlementColumns = map[string][]string{
+	"code":   {"CODE", "AOGUID"},
+	"name":   {"NAME", "FORMALNAME", "OFFNAME"},
+	"type":   {"SOCR", "SHORTNAME"},
+	"region": {"REGIONCODE"},
+	"post":   {"INDEX", "POSTALCODE"},
+	"level":  {"AOLEVEL"},
+	"status": {"ACTSTATUS"},
+}
+
+// FIAS levels of cities and settlements, other levels
+// are regions, districts, streets and so on
+var settlementLevels = map[string]bool{"4": true, "6": true}
+
+// FIAS level of regions
+const regionLevel = "1"
+
+// Moscow, Saint Petersburg and Sevastopol are cities and regions at once,
+// dumps only list them as regions, so their region records are imported
+// as settlements too
+var federalCityRegions = map[int]bool{77: true, 78: true, 92: true}
+
+// abbreviations used by the dumps which differ from display values of town types
+var townTypeAliases = map[string]string{
+	"п":       "пос",
+	"поселок": "пос",
+	"посёлок": "пос",
+	"ст":      "ст-ца",
+}
+
+func normalizeTownType(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = strings.TrimSuffix(value, ".")
+
+	if alias, ok := townTypeAliases[value]; ok {
+		return alias
+	}
+
+	return value
+}
+
+// reads cities and settlements from a UTF-8 CSV dump separated by commas or
+// semicolons, records which are not actual or not settlements are skipped
+func readSettlements(r io.Reader, fn func(settlementRecord) error) error {
+	buffered := bufio.NewReader(r)
+
+	headerLine, err := buffered.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	headerLine = strings.TrimPrefix(headerLine, "\ufeff")
+
+	reader := csv.NewReader(io.MultiReader(strings.NewReader(headerLine), buffered))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if strings.Count(headerLine, ";") > strings.Count(headerLine, ",") {
+		reader.Comma = ';'
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("settlements: %w", err)
+	}
+
+	index := make(map[string]int)
+
+	for column, names := range settlementColumns {
+		for i, name := range header {
+			if slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, strings.TrimSpace(name)) }) {
+				index[column] = i
+				break
+			}
+		}
+	}
+
+	for _, column := range []string{"code", "name"} {
+		if _, ok := index[column]; !ok {
+			return fmt.Errorf("settlements: no %s column, expected one of %v", column, settlementColumns[column])
+		}
+	}
+
+	field := func(record []string, column string) string {
+		i, ok := index[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("settlements: line %d: %w", line, err)
+		}
+
+		settlement := settlementRecord{
+			Code:     field(record, "code"),
+			Name:     field(record, "name"),
+			Type:     field(record, "type"),
+			PostCode: field(record, "post"),
+		}
+
+		if _, ok := index["status"]; ok && field(record, "status") != "1" {
+			continue
+		}
+
+		if region := field(record, "region"); len(region) > 0 {
+			if settlement.RegionCode, err = strconv.Atoi(region); err != nil {
+				return fmt.Errorf("settlements: line %d: invalid region code %q", line, region)
+			}
+		}
+
+		if _, ok := index["level"]; ok {
+			level := field(record, "level")
+			isFederalCity := level == regionLevel && federalCityRegions[settlement.RegionCode]
+
+			if !settlementLevels[level] && !isFederalCity {
+				continue
+			}
+		}
+
+		// KLADR codes are SS RRR GGG PPP AA: region, district, city,
+		// settlement and actuality, where actual records end with 00
+		if _, ok := index["region"]; !ok {
+			code := settlement.Code
+			if len(code) != 13 || code[11:] != "00" {
+				continue
+			}
+
+			if settlement.RegionCode, err = strconv.Atoi(code[:2]); err != nil {
+				return fmt.Errorf("settlements: line %d: invalid code %q", line, code)
+			}
+
+			isFederalCity := code[2:11] == "000000000" && federalCityRegions[settlement.RegionCode]
+
+			if code[5:11] == "000000" && !isFederalCity {
+				continue
+			}
+		}
+
+		if len(settlement.Code) == 0 || len(settlement.Name) == 0 || settlement.RegionCode == 0 {
+			continue
+		}
+
+		if err := fn(settlement); err != nil {
+			return err
+		}
+	}
+}
+
+const settlementsBatchSize = 1000
+
+type SettlementsImport struct {
+	Imported int64 `json:"imported"`
+	// settlements of regions missing from the regions dictionary
+	Skipped int64 `json:"skipped"`
+}
+
+// upserts settlements from a dump, settlements missing from
+// the dump are kept, so partial dumps can be imported one by one
+func ImportSettlements(db *gorm.DB, r io.Reader) (SettlementsImport, error) {
+	var result SettlementsImport
+
+	txFn := func(tx *gorm.DB) error {
+		var regions []models.DictRegion
+
+		if err := tx.Find(&regions).Error; err != nil {
+			return err
+		}
+
+		regionIDs := make(map[int]int, len(regions))
+		for _, region := range regions {
+			regionIDs[region.RegionID] = region.ID
+		}
+
+		var townTypes []models.DictTownType
+
+		if err := tx.Find(&townTypes).Error; err != nil {
+			return err
+		}
+
+		townTypeIDs := make(map[string]int, len(townTypes)*2)
+		for _, townType := range townTypes {
+			townTypeIDs[normalizeTownType(townType.Value)] = townType.ID
+			if townType.DisplayValue != nil {
+				townTypeIDs[normalizeTownType(*townType.DisplayValue)] = townType.ID
+			}
+		}
+
+		batch := make([]models.DictSettlement, 0, settlementsBatchSize)
+
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "code"}},
+				DoUpdates: clause.AssignmentColumns([]string{"region_id", "town_type_id", "name", "post_code"}),
+			}).Create(&batch).Error; err != nil {
+				return err
+			}
+
+			result.Imported += int64(len(batch))
+			batch = batch[:0]
+
+			return nil
+		}
+
+		add := func(record settlementRecord) error {
+			regionID, ok := regionIDs[record.RegionCode]
+			if !ok {
+				result.Skipped++
+				return nil
+			}
+
+			settlement := models.DictSettlement{
+				Code:     record.Code,
+				RegionID: regionID,
+				Name:     record.Name,
+			}
+
+			if townTypeID, ok := townTypeIDs[normalizeTownType(record.Type)]; ok {
+				settlement.TownTypeID = &townTypeID
+			}
+
+			if len(record.PostCode) > 0 {
+				postCode := record.PostCode
+				settlement.PostCode = &postCode
+			}
+
+			batch = append(batch, settlement)
+
+			if len(batch) == settlementsBatchSize {
+				return flush()
+			}
+
+			return nil
+		}
+
+		if err := readSettlements(r, add); err != nil {
+			return err
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		return Bump(tx, Settlements)
+	}
+
+	if err := db.Transaction(txFn); err != nil {
+		return SettlementsImport{}, err
+	}
+
+	return result, nil
+}
+
+// regions without any imported settlements accept any town
+func HasSettlements(db *gorm.DB, regionID int) (bool, error) {
+	var exists bool
+
+	err := db.Raw("SELECT EXISTS (SELECT 1 FROM dict_settlements WHERE region_id = ?)", regionID).Scan(&exists).Error
+
+	return exists, err
+}
+
+// whether the town belongs to the region, settlements
+// without a known town type match any type
+func IsSettlementOf(db *gorm.DB, regionID int, townTypeID int, town string) (bool, error) {
+	var count int64
+
+	err := db.
+		Model(&models.DictSettlement{}).
+		Where("region_id = ? AND lower(name) = lower(?)", regionID, strings.TrimSpace(town)).
+		Where("town_type_id IS NULL OR town_type_id = ?", townTypeID).
+		Count(&count).
+		Error
+
+	return count > 0, err
+}
@@ -0,0 +1,102 @@
+package dictionaries
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func collectSettlements(t *testing.T, dump string) []settlementRecord {
+	t.Helper()
+
+	var records []settlementRecord
+
+	err := readSettlements(strings.NewReader(dump), func(record settlementRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+func TestReadSettlementsKLADR(t *testing.T) {
+	dump := "\ufeffNAME;SOCR;CODE;INDEX;GNINMB;UNO;OCATD;STATUS\n" +
+		"Татарстан;Респ;1600000000000;;1600;;92000000000;0\n" +
+		"Альметьевский;р-н;1600500000000;423400;1644;;92208000000;0\n" +
+		"Казань;г;1600000100000;420000;1600;;92401000000;2\n" +
+		"Казань;г;1600000100051;;1600;;92401000000;0\n" +
+		"Альметьевск;г;1600500100000;423450;1644;;92404000000;1\n" +
+		"Абдрахманово;с;1600500000200;423441;1644;;92208802001;0\n"
+
+	want := []settlementRecord{
+		{Code: "1600000100000", RegionCode: 16, Type: "г", Name: "Казань", PostCode: "420000"},
+		{Code: "1600500100000", RegionCode: 16, Type: "г", Name: "Альметьевск", PostCode: "423450"},
+		{Code: "1600500000200", RegionCode: 16, Type: "с", Name: "Абдрахманово", PostCode: "423441"},
+	}
+
+	if got := collectSettlements(t, dump); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadSettlementsFIAS(t *testing.T) {
+	dump := "AOGUID,FORMALNAME,REGIONCODE,SHORTNAME,AOLEVEL,POSTALCODE,ACTSTATUS\n" +
+		"0c5b2444-70a0-4932-980c-b4dc0d3f02b5,Москва,77,г,1,,1\n" +
+		"0c5b2444-70a0-4932-980c-b4dc0d3f02b6,Татарстан,16,Респ,1,,1\n" +
+		"93b3df57-4c89-44df-ac42-96f05e9cd3b9,Казань,16,г,4,420000,1\n" +
+		"00000000-0000-0000-0000-000000000001,Казань,16,г,4,,0\n" +
+		"6d41b16e-6d6a-4b9d-a9e8-1f4b5d3f3c2a,Высокая Гора,16,с,6,,1\n" +
+		"2a1c7bdb-05ea-492f-9e1c-b3999f79dcbc,Баумана,16,ул,7,,1\n"
+
+	want := []settlementRecord{
+		{Code: "0c5b2444-70a0-4932-980c-b4dc0d3f02b5", RegionCode: 77, Type: "г", Name: "Москва"},
+		{Code: "93b3df57-4c89-44df-ac42-96f05e9cd3b9", RegionCode: 16, Type: "г", Name: "Казань", PostCode: "420000"},
+		{Code: "6d41b16e-6d6a-4b9d-a9e8-1f4b5d3f3c2a", RegionCode: 16, Type: "с", Name: "Высокая Гора"},
+	}
+
+	if got := collectSettlements(t, dump); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// federal cities are only listed as regions, while their towns are required
+func TestReadSettlementsFederalCities(t *testing.T) {
+	dump := "NAME;SOCR;CODE;INDEX\n" +
+		"Москва;г;7700000000000;101000\n" +
+		"Зеленоград;г;7700000200000;124460\n" +
+		"Санкт-Петербург;г;7800000000000;190000\n" +
+		"Севастополь;г;9200000000000;299000\n" +
+		"Москва;г;7700000000051;;\n" +
+		"Московская;обл;5000000000000;;\n"
+
+	want := []settlementRecord{
+		{Code: "7700000000000", RegionCode: 77, Type: "г", Name: "Москва", PostCode: "101000"},
+		{Code: "7700000200000", RegionCode: 77, Type: "г", Name: "Зеленоград", PostCode: "124460"},
+		{Code: "7800000000000", RegionCode: 78, Type: "г", Name: "Санкт-Петербург", PostCode: "190000"},
+		{Code: "9200000000000", RegionCode: 92, Type: "г", Name: "Севастополь", PostCode: "299000"},
+	}
+
+	if got := collectSettlements(t, dump); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	fias := "AOGUID,FORMALNAME,REGIONCODE,SHORTNAME,AOLEVEL,ACTSTATUS\n" +
+		"c2deb16a-0330-4f05-821f-1d09c93331e6,Санкт-Петербург,78,г,1,1\n" +
+		"6fdecb78-893a-4e3f-a5ba-aa062459463b,Севастополь,92,г,1,1\n" +
+		"29251dcf-00a1-4e34-98d4-5c47484a36d4,Московская,50,обл,1,1\n"
+
+	if got := collectSettlements(t, fias); len(got) != 2 || got[0].Name != "Санкт-Петербург" || got[1].RegionCode != 92 {
+		t.Errorf("federal cities must be imported from FIAS region records, got %+v", got)
+	}
+}
+
+func TestNormalizeTownType(t *testing.T) {
+	for value, want := range map[string]string{"г.": "г", "Г": "г", "п": "пос", "пос.": "пос", " с. ": "с", "ст-ца": "ст-ца"} {
+		if got := normalizeTownType(value); got != want {
+			t.Errorf("normalizeTownType(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package dictionaries
+
+import (
+	"fmt"
+	"imi/college/internal/models"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// locale values and display values of entries are written in
+const DefaultLocale = "ru"
+
+var Locales = []string{"ru", "en"}
+
+func IsLocale(locale string) bool {
+	for _, supported := range Locales {
+		if supported == locale {
+			return true
+		}
+	}
+	return false
+}
+
+// entries are identified by their ids written as text,
+// so entries with int and uuid ids share the table
+func EntryID(id any) string {
+	return fmt.Sprint(id)
+}
+
+func GetTranslations(db *gorm.DB, name string, entryID string) ([]models.DictTranslation, error) {
+	var translations []models.DictTranslation
+
+	err := db.
+		Where(&models.DictTranslation{Dictionary: name, EntryID: entryID}).
+		Order("locale").
+		Find(&translations).
+		Error
+
+	return translations, err
+}
+
+// sets display values of the entries to their translations, entries
+// without one display their value, unless the locale is the one
+// their display value is written in; majors only get their name replaced
+func Localize[T any](db *gorm.DB, name string, locale string, entries []T) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(entries))
+	for i := range entries {
+		ids[i] = EntryID(reflect.ValueOf(entries[i]).FieldByName("ID").Interface())
+	}
+
+	var translations []models.DictTranslation
+
+	if err := db.
+		Where("dictionary = ? AND locale = ? AND entry_id IN ?", name, locale, ids).
+		Find(&translations).
+		Error; err != nil {
+		return err
+	}
+
+	translated := make(map[string]string, len(translations))
+	for _, translation := range translations {
+		translated[translation.EntryID] = translation.DisplayValue
+	}
+
+	for i := range entries {
+		entry := reflect.ValueOf(&entries[i]).Elem()
+		value, ok := translated[ids[i]]
+
+		if name == Majors {
+			if ok {
+				entry.FieldByName("Name").SetString(value)
+			}
+			continue
+		}
+
+		displayValue := entry.FieldByName("DisplayValue")
+
+		switch {
+		case ok:
+		case locale == DefaultLocale && !displayValue.IsNil():
+			continue
+		default:
+			value = entry.FieldByName("Value").String()
+		}
+
+		displayValue.Set(reflect.ValueOf(&value))
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package dictionaries
+
+import (
+	"errors"
+	"imi/college/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// names of dictionaries as they appear in paths
+const (
+	TownTypes     = "towntypes"
+	Regions       = "regions"
+	Genders       = "genders"
+	EduLevels     = "edulevels"
+	Majors        = "majors"
+	AppStatuses   = "appstatuses"
+	IdDocTypes    = "iddoctypes"
+	EduDocTypes   = "edudoctypes"
+	Nationalities = "nationalities"
+	Settlements   = "settlements"
+)
+
+// must be called within the transaction changing the dictionary
+func Bump(tx *gorm.DB, name string) error {
+	version := models.DictionaryVersion{Name: name, Version: 1, UpdatedAt: time.Now()}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"version":    gorm.Expr("dictionary_versions.version + 1"),
+			"updated_at": version.UpdatedAt,
+		}),
+	}).Create(&version).Error
+}
+
+// dictionaries which have never changed are at version zero
+func GetVersion(db *gorm.DB, name string) (models.DictionaryVersion, error) {
+	var version models.DictionaryVersion
+
+	err := db.Where(&models.DictionaryVersion{Name: name}).First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DictionaryVersion{Name: name}, nil
+	}
+
+	return version, err
+}
+
+// grows with every change of any dictionary, since each
+// change bumps the version of a dictionary by one
+func GetRevision(db *gorm.DB) (int64, error) {
+	var revision int64
+
+	err := db.Model(&models.DictionaryVersion{}).Select("COALESCE(SUM(version), 0)").Scan(&revision).Error
+
+	return revision, err
+}
+
+// versions of the dictionaries keyed by their names
+func GetVersions(db *gorm.DB, names []string) (map[string]models.DictionaryVersion, error) {
+	var versions []models.DictionaryVersion
+
+	if err := db.Where("name IN ?", names).Find(&versions).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]models.DictionaryVersion, len(names))
+
+	for _, name := range names {
+		result[name] = models.DictionaryVersion{Name: name}
+	}
+
+	for _, version := range versions {
+		result[version.Name] = version
+	}
+
+	return result, nil
+}
@@ -1,7 +1,11 @@
 package env
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"strings"
+	"time"
 )
 
 func IsProduction() bool {
@@ -24,3 +28,157 @@ func DSN() string {
 	}
 	return value
 }
+
+// reads a duration like "48h" or "15m" from the environment and
+// falls back to the provided value if the variable is unset
+func durationOr(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if len(value) <= 0 {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Sprintf("%s environment variable is not a valid duration!", key))
+	}
+
+	return d
+}
+
+// lifetime of an access token, also the window by which
+// the token is extended when sliding expiration is enabled
+func SessionTTL() time.Duration {
+	return durationOr("SESSION_TTL", 48*time.Hour)
+}
+
+// if enabled, access tokens get their expiration pushed forward
+// each time they are used
+func SessionSliding() bool {
+	value := os.Getenv("SESSION_SLIDING")
+	return value == "true"
+}
+
+// minimal time between two expiration updates of the same token,
+// so active sessions don't cause a database write on every request
+func SessionTouchInterval() time.Duration {
+	return durationOr("SESSION_TOUCH_INTERVAL", 5*time.Minute)
+}
+
+// absolute lifetime of an access token, sliding expiration
+// never extends a token beyond its creation time plus this value
+func SessionMaxAge() time.Duration {
+	return durationOr("SESSION_MAX_AGE", 30*24*time.Hour)
+}
+
+func RefreshTokenTTL() time.Duration {
+	return durationOr("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// if enabled, accounts holding any permission bits can't
+// access other users' data until they enroll into 2FA
+func TwoFactorRequiredForStaff() bool {
+	value := os.Getenv("TOTP_REQUIRED_FOR_STAFF")
+	return value == "true"
+}
+
+// name shown by authenticator apps next to the account
+func TwoFactorIssuer() string {
+	value := os.Getenv("TOTP_ISSUER")
+	if len(value) <= 0 {
+		return "IMI College"
+	}
+	return value
+}
+
+// if enabled, access tokens are signed JWTs verified without
+// touching the database instead of opaque database backed tokens
+func SignedTokens() bool {
+	value := os.Getenv("TOKEN_MODE")
+	return value == "signed"
+}
+
+// comma separated list of "id:base64secret" pairs, the first
+// key signs new tokens and the rest are only used for verification
+func TokenSigningKeys() string {
+	value := os.Getenv("TOKEN_SIGNING_KEYS")
+	if len(value) <= 0 {
+		panic("TOKEN_SIGNING_KEYS environment variable is unset!")
+	}
+	return value
+}
+
+// signed tokens can't be extended, so they are meant to be
+// short-lived and renewed with refresh tokens
+func SignedTokenTTL() time.Duration {
+	return durationOr("SIGNED_TOKEN_TTL", 15*time.Minute)
+}
+
+// lifetime of tokens issued to staff impersonating applicants,
+// such tokens are never extended
+func ImpersonationTTL() time.Duration {
+	return durationOr("IMPERSONATION_TTL", 30*time.Minute)
+}
+
+// time given to dispose of personal data of a user
+// who has withdrawn their consent to its processing
+func ConsentRetentionPeriod() time.Duration {
+	return durationOr("CONSENT_RETENTION_PERIOD", 30*24*time.Hour)
+}
+
+// time a personal data export prepared in the background stays downloadable
+func ExportTTL() time.Duration {
+	return durationOr("EXPORT_TTL", 24*time.Hour)
+}
+
+// if enabled, dictionaries are filled from the embedded seeds on start,
+// otherwise seeds are only applied by the "seed" command
+func SeedOnStart() bool {
+	value := os.Getenv("SEED_ON_START")
+	return value != "false"
+}
+
+// if enabled, pending migrations are applied on start,
+// otherwise only by the "migrate up" command
+func MigrateOnStart() bool {
+	value := os.Getenv("MIGRATE_ON_START")
+	return value != "false"
+}
+
+// if enabled, towns of addresses must be settlements of the chosen region,
+// regions without imported settlements accept any town
+func ValidateAddressTowns() bool {
+	value := os.Getenv("ADDRESS_TOWN_VALIDATION")
+	return value == "true"
+}
+
+// comma separated list of addresses or CIDR ranges of reverse proxies,
+// X-Forwarded-For is only trusted on requests coming through them
+func TrustedProxies() []*net.IPNet {
+	value := os.Getenv("TRUSTED_PROXIES")
+	if len(value) <= 0 {
+		return nil
+	}
+
+	var proxies []*net.IPNet
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			panic("TRUSTED_PROXIES environment variable is not a valid list of addresses!")
+		}
+
+		proxies = append(proxies, network)
+	}
+
+	return proxies
+}
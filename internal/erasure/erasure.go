@@ -0,0 +1,211 @@
+package erasure
+
+import (
+	"errors"
+	"imi/college/internal/models"
+	"imi/college/internal/query"
+	"imi/college/internal/sessions"
+	"imi/college/internal/uploads"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrEnrolled = errors.New("user is referenced by an enrollment order")
+
+// retention requests failing with unexpected errors
+// are retried this many times before being blocked
+const maxRetentionFailures = 3
+
+type Options struct {
+	// erase the user even though an enrollment order references them
+	LegalHoldOverride bool
+}
+
+// erases users along with their personal data
+type Eraser struct {
+	db *gorm.DB
+	// nil unless the server issues signed tokens
+	signer *sessions.Signer
+}
+
+func New(db *gorm.DB, signer *sessions.Signer) *Eraser {
+	return &Eraser{db: db, signer: signer}
+}
+
+// deletes the user and everything referencing them, applications are
+// archived without anything identifying the user and uploaded files
+// are removed from disk once the deletion is committed
+func (e *Eraser) Erase(userID uuid.UUID, opts Options) error {
+	txFn := func(tx *gorm.DB) error {
+		user, err := query.GetUserByID(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if !opts.LegalHoldOverride {
+			enrolled, err := query.IsEnrolled(tx, user.ID)
+			if err != nil {
+				return err
+			}
+
+			if enrolled {
+				return ErrEnrolled
+			}
+		}
+
+		if err := query.EnsureAdminRemains(tx, user, 0); err != nil {
+			return err
+		}
+
+		if err := archiveApplications(tx, user.ID); err != nil {
+			return err
+		}
+
+		// exports are gone right away along with their archives
+		if err := tx.Where(&models.ExportJob{UserID: user.ID}).Delete(&models.ExportJob{}).Error; err != nil {
+			return err
+		}
+
+		// history has no foreign keys but holds personal data
+		if err := tx.Where(&models.ChangeRecord{OwnerID: user.ID}).Delete(&models.ChangeRecord{}).Error; err != nil {
+			return err
+		}
+
+		// requests are kept without the user as the proof of disposal
+		if err := tx.
+			Model(&models.RetentionRequest{}).
+			Where(&models.RetentionRequest{UserID: &user.ID}).
+			Where("completed_at IS NULL AND cancelled_at IS NULL").
+			Update("completed_at", time.Now()).
+			Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&user).Error
+	}
+
+	if err := e.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	// the user's tokens were deleted along with them
+	query.InvalidateUser(userID)
+	query.InvalidateTokens()
+
+	// signed tokens are verified without looking the user up, so every
+	// one of them, impersonation ones included, would outlive the user
+	if e.signer != nil {
+		if err := e.signer.RevokeUsers(e.db, []uuid.UUID{userID}); err != nil {
+			slog.Error("Couldn't revoke tokens of erased user", "userId", userID, "err", err.Error())
+		}
+	}
+
+	if err := uploads.RemoveUser(userID); err != nil {
+		slog.Error("Couldn't remove files of erased user", "userId", userID, "err", err.Error())
+	}
+
+	return nil
+}
+
+func archiveApplications(tx *gorm.DB, userID uuid.UUID) error {
+	var apps []models.Application
+
+	if err := tx.Where(&models.Application{UserID: userID}).Find(&apps).Error; err != nil {
+		return err
+	}
+
+	if len(apps) == 0 {
+		return nil
+	}
+
+	archived := make([]models.ArchivedApplication, 0, len(apps))
+
+	for _, app := range apps {
+		archived = append(archived, models.ArchivedApplication{
+			AppliedAt:         app.CreatedAt,
+			MajorID:           app.MajorID,
+			EduLevelID:        app.EduLevelID,
+			StatusID:          app.StatusID,
+			Priority:          app.Priority,
+			EnrollmentOrderID: app.EnrollmentOrderID,
+		})
+	}
+
+	return tx.Create(&archived).Error
+}
+
+// erases users whose retention requests are due, requests of users
+// who can't be erased, e.g. ones referenced by enrollment orders, are
+// marked as blocked and left for the staff to decide on; unexpected
+// errors don't stop the rest of the requests from being processed
+func (e *Eraser) ProcessRetention() error {
+	var requests []models.RetentionRequest
+
+	err := e.db.
+		Where("user_id IS NOT NULL AND completed_at IS NULL AND cancelled_at IS NULL AND blocked_at IS NULL").
+		Where("due_at <= ?", time.Now()).
+		Find(&requests).
+		Error
+
+	if err != nil {
+		return err
+	}
+
+	for _, request := range requests {
+		err := e.Erase(*request.UserID, Options{})
+
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrEnrolled), errors.Is(err, query.ErrLastAdmin):
+			slog.Warn("Retention request needs attention of the staff", "userId", *request.UserID, "err", err.Error())
+
+			if err := block(e.db, request, err.Error()); err != nil {
+				slog.Error("Couldn't block retention request", "requestId", request.ID, "err", err.Error())
+			}
+		default:
+			slog.Error("Couldn't process retention request", "requestId", request.ID, "userId", *request.UserID, "err", err.Error())
+
+			if err := fail(e.db, request, err.Error()); err != nil {
+				slog.Error("Couldn't record retention request failure", "requestId", request.ID, "err", err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// counts the failure and blocks the request once it keeps failing
+func fail(db *gorm.DB, request models.RetentionRequest, reason string) error {
+	updates := map[string]any{"failures": gorm.Expr("failures + 1")}
+
+	if request.Failures+1 >= maxRetentionFailures {
+		updates["blocked_at"] = time.Now()
+		updates["blocked_reason"] = reason
+	}
+
+	return db.Model(&request).Updates(updates).Error
+}
+
+func block(db *gorm.DB, request models.RetentionRequest, reason string) error {
+	return db.
+		Model(&request).
+		Updates(map[string]any{"blocked_at": time.Now(), "blocked_reason": reason}).
+		Error
+}
+
+// periodically erases users whose retention requests are due
+func (e *Eraser) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := e.ProcessRetention(); err != nil {
+				slog.Error("Couldn't process retention requests", "err", err.Error())
+			}
+		}
+	}()
+}
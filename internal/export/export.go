@@ -0,0 +1,208 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"imi/college/internal/models"
+	"imi/college/internal/query"
+	"imi/college/internal/uploads"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// accounts whose uploaded files take more space
+// than that are exported in the background
+const SyncLimit = 8 << 20
+
+type Application struct {
+	models.Application
+	// changes of the application including its status
+	History []models.ChangeRecord `json:"history"`
+}
+
+// everything stored about a user
+type Bundle struct {
+	User          models.User
+	Address       *models.UserAddress
+	Guardians     []models.Guardian
+	Consents      []models.Consent
+	IdentityDocs  []models.IdentityDoc
+	EducationDocs []models.EducationDoc
+	Applications  []Application
+	History       []models.ChangeRecord
+}
+
+func Collect(db *gorm.DB, userID uuid.UUID) (Bundle, error) {
+	var bundle Bundle
+	var err error
+
+	bundle.User, err = query.GetUserByID(db, userID)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	address, err := query.GetUserAddressByUserID(db, userID)
+	if err == nil {
+		bundle.Address = &address
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Bundle{}, err
+	}
+
+	if err := db.Where(&models.Guardian{UserID: userID}).Order("created_at ASC").Find(&bundle.Guardians).Error; err != nil {
+		return Bundle{}, err
+	}
+
+	if err := db.Where(&models.Consent{UserID: userID}).Order("accepted_at ASC").Find(&bundle.Consents).Error; err != nil {
+		return Bundle{}, err
+	}
+
+	if err := db.Where(&models.IdentityDoc{UserID: userID}).Joins("Type").Joins("Nationality").Joins("Status").Find(&bundle.IdentityDocs).Error; err != nil {
+		return Bundle{}, err
+	}
+
+	if err := db.Where(&models.EducationDoc{UserID: userID}).Find(&bundle.EducationDocs).Error; err != nil {
+		return Bundle{}, err
+	}
+
+	if err := db.Where(&models.ChangeRecord{OwnerID: userID}).Order("created_at ASC, id ASC").Find(&bundle.History).Error; err != nil {
+		return Bundle{}, err
+	}
+
+	var apps []models.Application
+
+	if err := db.Where(&models.Application{UserID: userID}).Joins("Status").Order("priority ASC").Find(&apps).Error; err != nil {
+		return Bundle{}, err
+	}
+
+	for _, app := range apps {
+		entry := Application{Application: app, History: []models.ChangeRecord{}}
+
+		for _, record := range bundle.History {
+			if record.EntityID == app.ID {
+				entry.History = append(entry.History, record)
+			}
+		}
+
+		bundle.Applications = append(bundle.Applications, entry)
+	}
+
+	return bundle, nil
+}
+
+// total size of files uploaded by the user
+func Size(userID uuid.UUID) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(uploads.UserDir(userID), func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	return size, err
+}
+
+func writeJSON(zw *zip.Writer, name string, value any) error {
+	out, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+func writeFiles(zw *zip.Writer, userID uuid.UUID) error {
+	entries, err := os.ReadDir(uploads.UserDir(userID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		if err := writeFile(zw, path.Join(uploads.UserDir(userID), entry.Name()), path.Join("files", entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFile(zw *zip.Writer, source string, name string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// writes the bundle as a ZIP archive of JSON files along
+// with the original files uploaded by the user
+func Write(w io.Writer, bundle Bundle) error {
+	zw := zip.NewWriter(w)
+
+	documents := []struct {
+		name  string
+		value any
+	}{
+		{"user.json", bundle.User},
+		{"details.json", bundle.User.Details},
+		{"address.json", bundle.Address},
+		{"guardians.json", bundle.Guardians},
+		{"consents.json", bundle.Consents},
+		{"documents/identity.json", bundle.IdentityDocs},
+		{"documents/education.json", bundle.EducationDocs},
+		{"applications.json", bundle.Applications},
+		{"history.json", bundle.History},
+	}
+
+	for _, document := range documents {
+		if err := writeJSON(zw, document.name, document.value); err != nil {
+			return err
+		}
+	}
+
+	if err := writeFiles(zw, bundle.User.ID); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,61 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"imi/college/internal/models"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestWrite(t *testing.T) {
+	bundle := Bundle{
+		User: models.User{
+			ID:       uuid.New(),
+			UserName: "applicant",
+			Details:  &models.UserDetails{FirstName: "Ivan"},
+		},
+		Applications: []Application{{Application: models.Application{ID: uuid.New()}}},
+	}
+
+	var buf bytes.Buffer
+
+	if err := Write(&buf, bundle); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	for _, name := range []string{"user.json", "details.json", "address.json", "documents/identity.json", "applications.json"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("archive must contain %s", name)
+		}
+	}
+
+	in, err := files["details.json"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer in.Close()
+
+	var details models.UserDetails
+
+	if err := json.NewDecoder(in).Decode(&details); err != nil {
+		t.Fatal(err)
+	}
+
+	if details.FirstName != "Ivan" {
+		t.Fatalf("details must be exported as is, got %q", details.FirstName)
+	}
+}
@@ -0,0 +1,121 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"imi/college/internal/models"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// directory which held exports before archives were moved to the
+// database, it's removed so no personal data is left behind
+const legacyJobsDir = ".exports"
+
+var ErrNotReady = errors.New("export is not ready yet")
+
+// prepares exports of large accounts in the background
+type Exporter struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+func NewExporter(db *gorm.DB, ttl time.Duration) *Exporter {
+	return &Exporter{db: db, ttl: ttl}
+}
+
+// creates the job and starts preparing the export
+func (e *Exporter) Start(userID uuid.UUID) (models.ExportJob, error) {
+	job := models.ExportJob{
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(e.ttl),
+	}
+
+	if err := e.db.Create(&job).Error; err != nil {
+		return models.ExportJob{}, err
+	}
+
+	go e.run(job)
+
+	return job, nil
+}
+
+func (e *Exporter) run(job models.ExportJob) {
+	err := e.prepare(job)
+	if err == nil {
+		return
+	}
+
+	slog.Error("Couldn't prepare personal data export", "jobId", job.ID, "err", err.Error())
+
+	if err := e.db.Model(&job).Updates(map[string]any{"completed_at": time.Now(), "failed": true}).Error; err != nil {
+		slog.Error("Couldn't complete personal data export", "jobId", job.ID, "err", err.Error())
+	}
+}
+
+// the job is completed along with storing its archive
+func (e *Exporter) prepare(job models.ExportJob) error {
+	bundle, err := Collect(e.db, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	var archive bytes.Buffer
+
+	if err := Write(&archive, bundle); err != nil {
+		return err
+	}
+
+	txFn := func(tx *gorm.DB) error {
+		if err := tx.Create(&models.ExportArchive{JobID: job.ID, Data: archive.Bytes()}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&job).Update("completed_at", time.Now()).Error
+	}
+
+	return e.db.Transaction(txFn)
+}
+
+// loads the prepared archive of the job
+func (e *Exporter) Open(job models.ExportJob) ([]byte, error) {
+	if job.CompletedAt == nil || job.Failed {
+		return nil, ErrNotReady
+	}
+
+	var archive models.ExportArchive
+
+	if err := e.db.Where(&models.ExportArchive{JobID: job.ID}).First(&archive).Error; err != nil {
+		return nil, err
+	}
+
+	return archive.Data, nil
+}
+
+// removes expired exports, archives are deleted along with their jobs
+func (e *Exporter) Cleanup() error {
+	if err := e.db.Where("expires_at <= ?", time.Now()).Delete(&models.ExportJob{}).Error; err != nil {
+		return err
+	}
+
+	return os.RemoveAll(legacyJobsDir)
+}
+
+// periodically removes expired exports in the background
+func (e *Exporter) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := e.Cleanup(); err != nil {
+				slog.Error("Couldn't clean up personal data exports", "err", err.Error())
+			}
+		}
+	}()
+}
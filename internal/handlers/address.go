@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"imi/college/internal/checks"
+	"imi/college/internal/dictionaries"
+	"imi/college/internal/env"
+	"imi/college/internal/history"
 	"imi/college/internal/httpx"
 	"imi/college/internal/models"
 	"imi/college/internal/permissions"
@@ -49,12 +52,31 @@ type AddressBody struct {
 	PostCode   string `json:"postCode" validate:"required"`
 }
 
+// towns are only checked in regions whose settlements have been imported
+func validateTown(tx *gorm.DB, body AddressBody) error {
+	hasSettlements, err := dictionaries.HasSettlements(tx, body.RegionID)
+	if err != nil || !hasSettlements {
+		return err
+	}
+
+	belongs, err := dictionaries.IsSettlementOf(tx, body.RegionID, body.TownTypeID, body.Town)
+	if err != nil {
+		return err
+	}
+
+	if !belongs {
+		return httpx.BadRequest("town doesn't belong to the chosen region")
+	}
+
+	return nil
+}
+
 func (h *AddressHandler) CreateOrUpdate(w http.ResponseWriter, r *http.Request) error {
 	if !checks.IsJson(r) {
 		return httpx.BadRequest("JSON body required")
 	}
 
-	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return httpx.NotFound()
@@ -89,10 +111,57 @@ func (h *AddressHandler) CreateOrUpdate(w http.ResponseWriter, r *http.Request)
 		Address:    body.Address,
 		PostCode:   body.PostCode,
 	}
-	if err := h.db.Debug().Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "user_id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"region_id", "town_type_id", "town", "post_code", "address"}),
-	}).Create(&newAddr).Error; err != nil {
+
+	actorID := httpx.GetActorID(r, currentUser)
+
+	txFn := func(tx *gorm.DB) error {
+		change := history.Change{
+			ActorID: &actorID,
+			OwnerID: targetUser.ID,
+			Entity:  history.EntityAddress,
+		}
+
+		if env.ValidateAddressTowns() {
+			if err := validateTown(tx, body); err != nil {
+				return err
+			}
+		}
+
+		oldAddr, err := query.GetUserAddressByUserID(tx, targetUser.ID)
+		hasOld := err == nil
+		if hasOld {
+			change.Before = oldAddr
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// addresses keep regions and town types retired after they were set
+		if !hasOld || oldAddr.RegionID != body.RegionID {
+			if err := requireAvailable(tx, &models.DictRegion{}, body.RegionID, "region"); err != nil {
+				return err
+			}
+		}
+
+		if !hasOld || oldAddr.TownTypeID != body.TownTypeID {
+			if err := requireAvailable(tx, &models.DictTownType{}, body.TownTypeID, "town type"); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"region_id", "town_type_id", "town", "post_code", "address"}),
+		}).Create(&newAddr).Error; err != nil {
+			return err
+		}
+
+		change.EntityID = newAddr.ID
+		change.After = newAddr
+
+		return history.Record(tx, change)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
 		return err
 	}
 
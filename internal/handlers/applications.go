@@ -3,6 +3,8 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"imi/college/internal/consent"
+	"imi/college/internal/history"
 	"imi/college/internal/httpx"
 	"imi/college/internal/models"
 	"imi/college/internal/permissions"
@@ -10,6 +12,8 @@ import (
 	"imi/college/internal/validation"
 	"imi/college/internal/writer"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
@@ -17,24 +21,89 @@ import (
 	"gorm.io/gorm"
 )
 
+var applicationsListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"priority":  {Column: "priority", Field: "Priority"},
+		"createdAt": {Column: "created_at", Field: "CreatedAt"},
+	},
+	DefaultSort: "priority",
+	Key:         query.SortField{Column: "id", Field: "ID"},
+	Filters: map[string]query.Filter{
+		"majorId":  {Column: "major_id", Parse: query.ParseUUID},
+		"statusId": {Column: "status_id", Parse: query.ParseInt},
+	},
+	DefaultLimit: 50,
+	MaxLimit:     200,
+}
+
 type ApplicationsHandler struct {
 	db *gorm.DB
 }
 
+// staff limited to certain majors only get to see
+// and change applications to those majors
+func scopeApplications(q *gorm.DB, currentUser models.User, targetUser models.User) (*gorm.DB, error) {
+	if currentUser.ID == targetUser.ID || permissions.HasAdmin(currentUser.EffectivePermissions()) {
+		return q, nil
+	}
+
+	majors, err := query.GetStaffScopeMajorIDs(q, currentUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(majors) == 0 {
+		return q, nil
+	}
+
+	return q.Where("major_id IN ?", majors), nil
+}
+
+// reports whether the staff member may apply the target user to the major
+func isMajorWithinScope(q *gorm.DB, currentUser models.User, targetUser models.User, majorID uuid.UUID) (bool, error) {
+	if currentUser.ID == targetUser.ID || permissions.HasAdmin(currentUser.EffectivePermissions()) {
+		return true, nil
+	}
+
+	majors, err := query.GetStaffScopeMajorIDs(q, currentUser.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return len(majors) == 0 || slices.Contains(majors, majorID), nil
+}
+
 // GET /users/{userId}/applications
+//
+// sorted by priority or createdAt and filtered by majorId or statusId
 func (h *ApplicationsHandler) Read(w http.ResponseWriter, r *http.Request) error {
-	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewUser)
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewApplications)
+	if err != nil {
+		return err
+	}
+
+	q, err := scopeApplications(h.db, currentUser, targetUser)
+	if err != nil {
+		return err
+	}
+
+	list, err := httpx.ParseList(r, applicationsListSpec)
 	if err != nil {
 		return err
 	}
 
 	var apps []models.Application
 
-	if err := h.db.Where(&models.Application{UserID: targetUser.ID}).Find(&apps).Error; err != nil {
+	if err := q.Where(&models.Application{UserID: targetUser.ID}).Scopes(list.Scope).Find(&apps).Error; err != nil {
 		return err
 	}
 
-	return writer.JSON(w, http.StatusOK, apps)
+	apps, nextCursor, err := query.Paginate(list, apps)
+	if err != nil {
+		return err
+	}
+
+	return writer.Paginated(w, http.StatusOK, apps, nextCursor)
 }
 
 type CreateApplicationBody struct {
@@ -43,7 +112,7 @@ type CreateApplicationBody struct {
 }
 
 func (h *ApplicationsHandler) Create(w http.ResponseWriter, r *http.Request) error {
-	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditApplications)
 	if err != nil {
 		return err
 	}
@@ -73,7 +142,41 @@ func (h *ApplicationsHandler) Create(w http.ResponseWriter, r *http.Request) err
 		EduLevelID: body.EduLevelID,
 	}
 
+	actorID := httpx.GetActorID(r, currentUser)
+
 	txFn := func(tx *gorm.DB) error {
+		if err := consent.Check(tx, targetUser); err != nil {
+			return consentError(err)
+		}
+
+		if targetUser.Details != nil && consent.IsMinor(targetUser.Details.Birthday, time.Now()) {
+			hasGuardian, err := query.HasGuardian(tx, targetUser.ID)
+			if err != nil {
+				return err
+			}
+
+			if !hasGuardian {
+				return httpx.GuardianRequired()
+			}
+		}
+
+		withinScope, err := isMajorWithinScope(tx, currentUser, targetUser, body.MajorID)
+		if err != nil {
+			return err
+		}
+
+		if !withinScope {
+			return httpx.Forbidden()
+		}
+
+		if err := requireAvailable(tx, &models.CollegeMajor{}, body.MajorID, "major"); err != nil {
+			return err
+		}
+
+		if err := requireAvailable(tx, &models.DictEduLevel{}, body.EduLevelID, "education level"); err != nil {
+			return err
+		}
+
 		status, err := query.GetDefaultAppStatus(tx)
 		if err != nil {
 			return err
@@ -89,11 +192,17 @@ func (h *ApplicationsHandler) Create(w http.ResponseWriter, r *http.Request) err
 
 		application.Priority = topPriorityApp.Priority + 1
 
-		if err := h.db.Create(&application).Error; err != nil {
+		if err := tx.Create(&application).Error; err != nil {
 			return err
 		}
 
-		return nil
+		return history.Record(tx, history.Change{
+			ActorID:  &actorID,
+			OwnerID:  targetUser.ID,
+			Entity:   history.EntityApplication,
+			EntityID: application.ID,
+			After:    application,
+		})
 	}
 
 	if err := h.db.Transaction(txFn); err != nil {
@@ -105,7 +214,7 @@ func (h *ApplicationsHandler) Create(w http.ResponseWriter, r *http.Request) err
 
 // DELETE /users/{userId}/applications/{appId}
 func (h *ApplicationsHandler) Delete(w http.ResponseWriter, r *http.Request) error {
-	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditApplications)
 	if err != nil {
 		return err
 	}
@@ -117,8 +226,15 @@ func (h *ApplicationsHandler) Delete(w http.ResponseWriter, r *http.Request) err
 
 	var targetApp models.Application
 
+	actorID := httpx.GetActorID(r, currentUser)
+
 	txFn := func(tx *gorm.DB) error {
-		if err := tx.Where(&models.Application{UserID: targetUser.ID, ID: appId}).First(&targetApp).Error; err != nil {
+		q, err := scopeApplications(tx, currentUser, targetUser)
+		if err != nil {
+			return err
+		}
+
+		if err := q.Where(&models.Application{UserID: targetUser.ID, ID: appId}).First(&targetApp).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				return httpx.NotFound()
 			}
@@ -129,6 +245,16 @@ func (h *ApplicationsHandler) Delete(w http.ResponseWriter, r *http.Request) err
 			return err
 		}
 
+		if err := history.Record(tx, history.Change{
+			ActorID:  &actorID,
+			OwnerID:  targetUser.ID,
+			Entity:   history.EntityApplication,
+			EntityID: targetApp.ID,
+			Before:   targetApp,
+		}); err != nil {
+			return err
+		}
+
 		return tx.
 			Model(&models.Application{}).
 			Where(&models.Application{UserID: targetUser.ID}).
@@ -141,9 +267,5 @@ func (h *ApplicationsHandler) Delete(w http.ResponseWriter, r *http.Request) err
 		return err
 	}
 
-	if err := h.db.Transaction(txFn); err != nil {
-		return err
-	}
-
 	return writer.JSON(w, http.StatusOK, targetApp)
 }
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"imi/college/internal/audit"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/query"
+	"imi/college/internal/writer"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+var auditListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"createdAt": {Column: "created_at", Field: "CreatedAt"},
+	},
+	DefaultSort: "-createdAt",
+	Key:         query.SortField{Column: "id", Field: "ID"},
+	Filters: map[string]query.Filter{
+		"actorId":      {Column: "actor_id", Parse: query.ParseUUID},
+		"targetId":     {Column: "target_id", Parse: query.ParseUUID},
+		"action":       {Column: "action", Parse: query.ParseOneOf(audit.ActionRead, audit.ActionModify)},
+		"impersonated": {Column: "impersonated", Parse: query.ParseBool},
+		"from":         {Column: "created_at", Operator: ">=", Parse: query.ParseTime},
+		"to":           {Column: "created_at", Operator: "<", Parse: query.ParseTime},
+	},
+	DefaultLimit: 50,
+	MaxLimit:     200,
+}
+
+type AuditHandler struct {
+	db *gorm.DB
+}
+
+// GET /audit
+//
+// entries can be filtered by actorId, targetId, action, impersonated,
+// from and to (RFC 3339); newest entries come first and pages are
+// requested with limit and the cursor returned along with the previous page
+func (h *AuditHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	list, err := httpx.ParseList(r, auditListSpec)
+	if err != nil {
+		return err
+	}
+
+	var entries []models.AuditEntry
+
+	if err := h.db.Model(&models.AuditEntry{}).Scopes(list.Scope).Find(&entries).Error; err != nil {
+		return err
+	}
+
+	entries, nextCursor, err := query.Paginate(list, entries)
+	if err != nil {
+		return err
+	}
+
+	return writer.Paginated(w, http.StatusOK, entries, nextCursor)
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"imi/college/internal/checks"
+	"imi/college/internal/consent"
+	"imi/college/internal/env"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/validation"
+	"imi/college/internal/writer"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+type ConsentsHandler struct {
+	db *gorm.DB
+}
+
+// maps consent check failures to API errors
+func consentError(err error) error {
+	switch {
+	case errors.Is(err, consent.ErrNoVersion):
+		return httpx.ConsentTermsUnavailable()
+	case errors.Is(err, consent.ErrMissing), errors.Is(err, consent.ErrOutdated):
+		return httpx.ConsentRequired()
+	case errors.Is(err, consent.ErrParentRequired):
+		return httpx.ParentalConsentRequired()
+	default:
+		return err
+	}
+}
+
+// GET /consents
+func (h *ConsentsHandler) ReadVersions(w http.ResponseWriter, r *http.Request) error {
+	var versions []models.ConsentVersion
+
+	if err := h.db.Order("effective_at DESC, id DESC").Find(&versions).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, versions)
+}
+
+// GET /consents/current
+//
+// terms new applicants have to accept
+func (h *ConsentsHandler) ReadCurrent(w http.ResponseWriter, r *http.Request) error {
+	version, err := consent.CurrentVersion(h.db)
+	if err != nil {
+		if errors.Is(err, consent.ErrNoVersion) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, version)
+}
+
+type CreateConsentVersionBody struct {
+	Text        string    `json:"text" validate:"required"`
+	EffectiveAt time.Time `json:"effectiveAt" validate:"required"`
+}
+
+// POST /consents
+//
+// publishes new terms, once they come into effect applicants
+// who have accepted older terms have to accept them again
+func (h *ConsentsHandler) CreateVersion(w http.ResponseWriter, r *http.Request) error {
+	if !checks.IsJson(r) {
+		return httpx.MalformedJSON()
+	}
+
+	var body CreateConsentVersionBody
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return httpx.InvalidRequest(cause)
+		}
+		return err
+	}
+
+	version := models.ConsentVersion{
+		Text:        body.Text,
+		EffectiveAt: body.EffectiveAt,
+	}
+
+	if err := h.db.Create(&version).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, version)
+}
+
+// GET /users/{userId}/consents
+func (h *ConsentsHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var consents []models.Consent
+
+	if err := h.db.Where(&models.Consent{UserID: targetUser.ID}).Order("accepted_at DESC").Find(&consents).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, consents)
+}
+
+type AcceptConsentBody struct {
+	VersionID int `json:"versionId" validate:"required"`
+	// required if the applicant is a minor
+	ParentName *string `json:"parentName" validate:"omitnil,gte=2"`
+}
+
+// POST /users/{userId}/consents
+//
+// accepts the terms in effect, e.g. after they have changed
+// or when consent of a parent is brought by the staff
+func (h *ConsentsHandler) Accept(w http.ResponseWriter, r *http.Request) error {
+	if !checks.IsJson(r) {
+		return httpx.MalformedJSON()
+	}
+
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var body AcceptConsentBody
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return httpx.InvalidRequest(cause)
+		}
+		return err
+	}
+
+	var accepted models.Consent
+
+	txFn := func(tx *gorm.DB) error {
+		var err error
+
+		accepted, err = acceptConsent(tx, r, targetUser, body.VersionID, body.ParentName)
+		if err != nil {
+			return err
+		}
+
+		return consent.CancelRetention(tx, targetUser.ID)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, accepted)
+}
+
+// stores consent of the user to the version in effect, user's
+// details must be loaded to tell whether they are a minor
+func acceptConsent(tx *gorm.DB, r *http.Request, user models.User, versionID int, parentName *string) (models.Consent, error) {
+	version, err := consent.CurrentVersion(tx)
+	if err != nil {
+		return models.Consent{}, consentError(err)
+	}
+
+	if versionID != version.ID {
+		return models.Consent{}, httpx.ConsentRequired()
+	}
+
+	if user.Details != nil && consent.IsMinor(user.Details.Birthday, time.Now()) && parentName == nil {
+		return models.Consent{}, httpx.ParentalConsentRequired()
+	}
+
+	accepted := models.Consent{
+		UserID:     user.ID,
+		VersionID:  version.ID,
+		AcceptedAt: time.Now(),
+		IP:         httpx.ClientIP(r),
+		ParentName: parentName,
+	}
+
+	if err := tx.Create(&accepted).Error; err != nil {
+		return models.Consent{}, err
+	}
+
+	return accepted, nil
+}
+
+// POST /users/{userId}/consents/withdraw
+//
+// withdraws the user's consent, their personal data is scheduled
+// to be disposed of and they can no longer submit applications
+func (h *ConsentsHandler) Withdraw(w http.ResponseWriter, r *http.Request) error {
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var request models.RetentionRequest
+
+	txFn := func(tx *gorm.DB) error {
+		var err error
+
+		request, err = consent.Withdraw(tx, targetUser.ID, env.ConsentRetentionPeriod())
+		return err
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, request)
+}
+
+// GET /retention
+//
+// users whose personal data is yet to be disposed of, earliest due first;
+// blocked requests are listed until the staff erases the user or the
+// user gives their consent again
+func (h *ConsentsHandler) ReadRetention(w http.ResponseWriter, r *http.Request) error {
+	var requests []models.RetentionRequest
+
+	err := h.db.
+		Where("completed_at IS NULL AND cancelled_at IS NULL").
+		Order("due_at ASC").
+		Find(&requests).
+		Error
+
+	if err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, requests)
+}
@@ -1,122 +1,486 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"imi/college/internal/cache"
+	"imi/college/internal/dictionaries"
+	"imi/college/internal/httpx"
 	"imi/college/internal/models"
+	"imi/college/internal/query"
 	"imi/college/internal/writer"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
 )
 
+// dictionaries are small, so a plain request gets every entry at once
+var dictionaryListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"id":    {Column: "id", Field: "ID"},
+		"value": {Column: "value", Field: "Value"},
+	},
+	DefaultSort:  "id",
+	Key:          query.SortField{Column: "id", Field: "ID"},
+	DefaultLimit: 1000,
+	MaxLimit:     1000,
+}
+
+var regionsListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"id":       {Column: "id", Field: "ID"},
+		"value":    {Column: "value", Field: "Value"},
+		"regionId": {Column: "region_id", Field: "RegionID"},
+	},
+	DefaultSort:  "id",
+	Key:          query.SortField{Column: "id", Field: "ID"},
+	DefaultLimit: 1000,
+	MaxLimit:     1000,
+}
+
+var nationalitiesListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"id":           {Column: "id", Field: "ID"},
+		"value":        {Column: "value", Field: "Value"},
+		"sortPriority": {Column: "sort_priority", Field: "SortPriority"},
+	},
+	DefaultSort:  "id",
+	Key:          query.SortField{Column: "id", Field: "ID"},
+	DefaultLimit: 1000,
+	MaxLimit:     1000,
+}
+
+var majorsListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"name": {Column: "name", Field: "Name"},
+		"code": {Column: "code", Field: "Code"},
+	},
+	DefaultSort: "name",
+	Key:         query.SortField{Column: "id", Field: "ID"},
+	Filters: map[string]query.Filter{
+		"budget": {Column: "budget", Parse: query.ParseBool},
+	},
+	DefaultLimit: 1000,
+	MaxLimit:     1000,
+}
+
+// towns are looked up as the user types, so only a few are listed at once
+var townsListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"name": {Column: "name", Field: "Name"},
+	},
+	DefaultSort: "name",
+	Key:         query.SortField{Column: "code", Field: "Code"},
+	Filters: map[string]query.Filter{
+		"townTypeId": {Column: "town_type_id", Parse: query.ParseInt},
+	},
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
 type DictionariesHandler struct {
 	db *gorm.DB
+	// responses keyed by the revision of dictionaries, the dictionary
+	// and request parameters, cleared whenever any dictionary changes
+	cache cache.Cache[string, dictionaryResponse]
 }
 
-// GET /dictionaries/towntypes
-func (h *DictionariesHandler) ReadTownTypes(w http.ResponseWriter, r *http.Request) error {
-	var data []models.DictTownType
+// dictionaries change a few times a year, responses of older
+// revisions are never requested again and just wait to expire
+const dictionaryCacheTTL = 10 * time.Minute
 
-	if err := h.db.Model(&models.DictTownType{}).Find(&data).Error; err != nil {
-		return err
+func NewDictionariesHandler(db *gorm.DB) DictionariesHandler {
+	responses := cache.NewMemory[string, dictionaryResponse](1000, dictionaryCacheTTL)
+	cache.Publish("dictionaries", responses)
+
+	return DictionariesHandler{db: db, cache: responses}
+}
+
+type dictionaryResponse struct {
+	etag         string
+	lastModified time.Time
+	data         any
+	nextCursor   *string
+}
+
+// dictionaries are read by everyone, so the response is built once
+// and served from the cache until any of them changes; the revision is
+// read on every request, so neither responses built while a change was
+// being committed nor changes made by other instances leave stale entries
+func (h *DictionariesHandler) cached(key string, build func() (dictionaryResponse, error)) (dictionaryResponse, error) {
+	revision, err := dictionaries.GetRevision(h.db)
+	if err != nil {
+		return dictionaryResponse{}, err
 	}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
+	key = strconv.FormatInt(revision, 10) + "@" + key
+
+	if response, ok := h.cache.Get(key); ok {
+		return response, nil
+	}
+
+	response, err := build()
+	if err != nil {
+		return dictionaryResponse{}, err
+	}
+
+	h.cache.Set(key, response)
+
+	return response, nil
 }
 
-// GET /dictionaries/regions
-func (h *DictionariesHandler) ReadRegions(w http.ResponseWriter, r *http.Request) error {
-	var data []models.DictRegion
+// every entry of a dictionary, as included in the bundle
+type bundledDictionary func(db *gorm.DB, locale string, includeRetired bool) (any, error)
 
-	if err := h.db.Model(models.DictRegion{}).Find(&data).Error; err != nil {
-		return err
+func bundle[T any](name string, order string) bundledDictionary {
+	return func(db *gorm.DB, locale string, includeRetired bool) (any, error) {
+		q := db.Model(new(T)).Order(order)
+
+		if !includeRetired {
+			q = q.Where("retired_at IS NULL")
+		}
+
+		var entries []T
+
+		if err := q.Find(&entries).Error; err != nil {
+			return nil, err
+		}
+
+		if err := dictionaries.Localize(db, name, locale, entries); err != nil {
+			return nil, err
+		}
+
+		return entries, nil
 	}
+}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
+// settlements are left out, there are too many of them
+var dictionaryBundle = map[string]bundledDictionary{
+	dictionaries.TownTypes:     bundle[models.DictTownType](dictionaries.TownTypes, "id"),
+	dictionaries.Regions:       bundle[models.DictRegion](dictionaries.Regions, "id"),
+	dictionaries.Genders:       bundle[models.DictGender](dictionaries.Genders, "id"),
+	dictionaries.EduLevels:     bundle[models.DictEduLevel](dictionaries.EduLevels, "id"),
+	dictionaries.Majors:        bundle[models.CollegeMajor](dictionaries.Majors, "name, id"),
+	dictionaries.AppStatuses:   bundle[models.DictAppStatus](dictionaries.AppStatuses, "id"),
+	dictionaries.IdDocTypes:    bundle[models.DictIdDocType](dictionaries.IdDocTypes, "id"),
+	dictionaries.EduDocTypes:   bundle[models.DictEduDocType](dictionaries.EduDocTypes, "id"),
+	dictionaries.Nationalities: bundle[models.DictNationality](dictionaries.Nationalities, "id"),
 }
 
-// GET /dictionaries/genders
-func (h *DictionariesHandler) ReadGenders(w http.ResponseWriter, r *http.Request) error {
-	var data []models.DictGender
+// dictionaries requested with ?names=regions,genders, all of them by default
+func getBundleNames(r *http.Request) ([]string, error) {
+	var names []string
 
-	if err := h.db.Model(models.DictGender{}).Find(&data).Error; err != nil {
-		return err
+	if raw := r.URL.Query().Get("names"); len(raw) > 0 {
+		for _, name := range strings.Split(raw, ",") {
+			name = strings.TrimSpace(name)
+
+			if _, ok := dictionaryBundle[name]; !ok {
+				return nil, httpx.BadRequest(fmt.Sprintf("unknown dictionary %q", name))
+			}
+
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	} else {
+		for name := range dictionaryBundle {
+			names = append(names, name)
+		}
 	}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
+	sort.Strings(names)
+
+	return names, nil
 }
 
-// GET /dictionaries/edulevels
-func (h *DictionariesHandler) ReadEduLevels(w http.ResponseWriter, r *http.Request) error {
-	var data []models.DictEduLevel
+// the bundle only changes along with versions of its dictionaries, so
+// the validator is strong; it differs per locale and content coding,
+// the latter is added by withContentCoding
+func bundleETag(names []string, versions map[string]models.DictionaryVersion, locale string, includeRetired bool) (string, time.Time) {
+	hash := fnv.New64a()
+	var lastModified time.Time
 
-	if err := h.db.Model(models.DictEduLevel{}).Find(&data).Error; err != nil {
-		return err
+	for _, name := range names {
+		version := versions[name]
+		fmt.Fprintf(hash, "%s=%d;", name, version.Version)
+
+		if version.UpdatedAt.After(lastModified) {
+			lastModified = version.UpdatedAt
+		}
 	}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
+	fmt.Fprintf(hash, "%s;%t", locale, includeRetired)
+
+	return fmt.Sprintf(`"%x"`, hash.Sum64()), lastModified
 }
 
-// GET /dictionaries/majors
-func (h *DictionariesHandler) ReadMajors(w http.ResponseWriter, r *http.Request) error {
-	var data []models.CollegeMajor
+// strong validators must differ between encodings of the same response
+func withContentCoding(etag string, gzipped bool) string {
+	if !gzipped {
+		return etag
+	}
+
+	return strings.TrimSuffix(etag, `"`) + `-gzip"`
+}
+
+// entries are versioned per dictionary, while the response also
+// depends on list parameters and locale, hence the weak validator
+func dictionaryETag(r *http.Request, version models.DictionaryVersion, locale string) string {
+	hash := fnv.New64a()
+	hash.Write([]byte(r.URL.Query().Encode()))
+	hash.Write([]byte(locale))
+
+	return fmt.Sprintf(`W/"%d-%x"`, version.Version, hash.Sum64())
+}
+
+// responses differ by the dictionary, list parameters and locale
+func dictionaryCacheKey(r *http.Request, name string, locale string) string {
+	return name + "?" + r.URL.Query().Encode() + "#" + locale
+}
 
-	if err := h.db.Model(models.CollegeMajor{}).Find(&data).Error; err != nil {
+// retired entries are only listed with ?includeRetired=true,
+// display values are in the locale negotiated with the client
+func readDictionary[T any](h *DictionariesHandler, w http.ResponseWriter, r *http.Request, name string, spec query.ListSpec) error {
+	list, err := httpx.ParseList(r, spec)
+	if err != nil {
 		return err
 	}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
-}
+	locale := httpx.GetLocale(r, dictionaries.Locales, dictionaries.DefaultLocale)
 
-// GET /dictionaries/appstatuses
-func (h *DictionariesHandler) ReadAppStatuses(w http.ResponseWriter, r *http.Request) error {
-	var data []models.DictAppStatus
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+
+	build := func() (dictionaryResponse, error) {
+		version, err := dictionaries.GetVersion(h.db, name)
+		if err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		q := h.db.Model(new(T))
+
+		if r.URL.Query().Get("includeRetired") != "true" {
+			q = q.Where("retired_at IS NULL")
+		}
 
-	if err := h.db.Model(models.DictAppStatus{}).Find(&data).Error; err != nil {
+		var data []T
+
+		if err := q.Scopes(list.Scope).Find(&data).Error; err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		data, nextCursor, err := query.Paginate(list, data)
+		if err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		if err := dictionaries.Localize(h.db, name, locale, data); err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		return dictionaryResponse{
+			etag:         dictionaryETag(r, version, locale),
+			lastModified: version.UpdatedAt,
+			data:         data,
+			nextCursor:   nextCursor,
+		}, nil
+	}
+
+	response, err := h.cached(dictionaryCacheKey(r, name, locale), build)
+	if err != nil {
 		return err
 	}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
+	if httpx.NotModified(w, r, response.etag, response.lastModified) {
+		return nil
+	}
+
+	return writer.Paginated(w, http.StatusOK, response.data.([]T), response.nextCursor)
+}
+
+// GET /dictionaries/towntypes
+func (h *DictionariesHandler) ReadTownTypes(w http.ResponseWriter, r *http.Request) error {
+	return readDictionary[models.DictTownType](h, w, r, dictionaries.TownTypes, dictionaryListSpec)
+}
+
+// GET /dictionaries/regions
+func (h *DictionariesHandler) ReadRegions(w http.ResponseWriter, r *http.Request) error {
+	return readDictionary[models.DictRegion](h, w, r, dictionaries.Regions, regionsListSpec)
+}
+
+// GET /dictionaries/genders
+func (h *DictionariesHandler) ReadGenders(w http.ResponseWriter, r *http.Request) error {
+	return readDictionary[models.DictGender](h, w, r, dictionaries.Genders, dictionaryListSpec)
+}
+
+// GET /dictionaries/edulevels
+func (h *DictionariesHandler) ReadEduLevels(w http.ResponseWriter, r *http.Request) error {
+	return readDictionary[models.DictEduLevel](h, w, r, dictionaries.EduLevels, dictionaryListSpec)
+}
+
+// GET /dictionaries/majors
+func (h *DictionariesHandler) ReadMajors(w http.ResponseWriter, r *http.Request) error {
+	return readDictionary[models.CollegeMajor](h, w, r, dictionaries.Majors, majorsListSpec)
+}
+
+// GET /dictionaries/appstatuses
+func (h *DictionariesHandler) ReadAppStatuses(w http.ResponseWriter, r *http.Request) error {
+	return readDictionary[models.DictAppStatus](h, w, r, dictionaries.AppStatuses, dictionaryListSpec)
 }
 
 // GET /dictionaries/iddoctypes
 func (h *DictionariesHandler) ReadIdDocTypes(w http.ResponseWriter, r *http.Request) error {
-	var data []models.DictEduLevel
+	return readDictionary[models.DictIdDocType](h, w, r, dictionaries.IdDocTypes, dictionaryListSpec)
+}
+
+// GET /dictionaries/edudoctypes
+func (h *DictionariesHandler) ReadEduDocTypes(w http.ResponseWriter, r *http.Request) error {
+	return readDictionary[models.DictEduDocType](h, w, r, dictionaries.EduDocTypes, dictionaryListSpec)
+}
+
+// GET /dictionaries/nationalities
+func (h *DictionariesHandler) ReadNationalities(w http.ResponseWriter, r *http.Request) error {
+	return readDictionary[models.DictNationality](h, w, r, dictionaries.Nationalities, nationalitiesListSpec)
+}
+
+// GET /dictionaries/regions/{regionId}/towns?q=
+//
+// settlements of the region whose names start with q
+func (h *DictionariesHandler) ReadTowns(w http.ResponseWriter, r *http.Request) error {
+	regionID, err := strconv.Atoi(chi.URLParam(r, "regionId"))
+	if err != nil {
+		return httpx.UnprocessableEntity()
+	}
 
-	if err := h.db.Model(models.DictIdDocType{}).Find(&data).Error; err != nil {
+	list, err := httpx.ParseList(r, townsListSpec)
+	if err != nil {
 		return err
 	}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
-}
+	build := func() (dictionaryResponse, error) {
+		var region models.DictRegion
 
-// GET /dictionaries/iddoctypes
-func (h *DictionariesHandler) ReadEduDocTypes(w http.ResponseWriter, r *http.Request) error {
-	var data []models.DictEduLevel
+		if err := h.db.First(&region, regionID).Error; err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		version, err := dictionaries.GetVersion(h.db, dictionaries.Settlements)
+		if err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		q := h.db.Where(&models.DictSettlement{RegionID: region.ID})
+
+		if prefix := strings.TrimSpace(r.URL.Query().Get("q")); len(prefix) > 0 {
+			q = q.Where("lower(name) LIKE ?", query.EscapeLike(strings.ToLower(prefix))+"%")
+		}
+
+		var towns []models.DictSettlement
+
+		if err := q.Scopes(list.Scope).Find(&towns).Error; err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		towns, nextCursor, err := query.Paginate(list, towns)
+		if err != nil {
+			return dictionaryResponse{}, err
+		}
 
-	if err := h.db.Model(models.DictEduDocType{}).Find(&data).Error; err != nil {
+		return dictionaryResponse{
+			etag:         dictionaryETag(r, version, ""),
+			lastModified: version.UpdatedAt,
+			data:         towns,
+			nextCursor:   nextCursor,
+		}, nil
+	}
+
+	response, err := h.cached(dictionaryCacheKey(r, fmt.Sprintf("%s/%d", dictionaries.Settlements, regionID), ""), build)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
 		return err
 	}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
+	if httpx.NotModified(w, r, response.etag, response.lastModified) {
+		return nil
+	}
+
+	return writer.Paginated(w, http.StatusOK, response.data.([]models.DictSettlement), response.nextCursor)
 }
 
-// GET /dictionaries/nationalities
-func (h *DictionariesHandler) ReadNationalities(w http.ResponseWriter, r *http.Request) error {
-	var data []models.DictNationality
+// GET /dictionaries?names=
+//
+// every dictionary, or only the named ones, in a single response
+func (h *DictionariesHandler) ReadAll(w http.ResponseWriter, r *http.Request) error {
+	names, err := getBundleNames(r)
+	if err != nil {
+		return err
+	}
 
-	if err := h.db.Model(models.DictNationality{}).Find(&data).Error; err != nil {
+	includeRetired := r.URL.Query().Get("includeRetired") == "true"
+	locale := httpx.GetLocale(r, dictionaries.Locales, dictionaries.DefaultLocale)
+	gzipped := httpx.AcceptsGzip(r)
+
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	build := func() (dictionaryResponse, error) {
+		var response dictionaryResponse
+		result := make(map[string]any, len(names))
+
+		// versions and entries are read from the same snapshot,
+		// so the validator always matches the entries
+		txFn := func(tx *gorm.DB) error {
+			versions, err := dictionaries.GetVersions(tx, names)
+			if err != nil {
+				return err
+			}
+
+			response.etag, response.lastModified = bundleETag(names, versions, locale, includeRetired)
+
+			for _, name := range names {
+				if result[name], err = dictionaryBundle[name](tx, locale, includeRetired); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		if err := h.db.Transaction(txFn, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}); err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		response.data = result
+
+		return response, nil
+	}
+
+	key := fmt.Sprintf("*?names=%s&includeRetired=%t#%s", strings.Join(names, ","), includeRetired, locale)
+
+	response, err := h.cached(key, build)
+	if err != nil {
 		return err
 	}
 
-	writer.SetCacheControlSWR(w, 24*time.Hour, 6*time.Hour)
-	return writer.JSON(w, http.StatusOK, data)
+	if httpx.NotModified(w, r, withContentCoding(response.etag, gzipped), response.lastModified) {
+		return nil
+	}
+
+	if gzipped {
+		return writer.GzipJSON(w, http.StatusOK, response.data)
+	}
+
+	return writer.JSON(w, http.StatusOK, response.data)
 }
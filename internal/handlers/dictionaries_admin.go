@@ -0,0 +1,736 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"imi/college/internal/checks"
+	"imi/college/internal/ctx"
+	"imi/college/internal/dictionaries"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/validation"
+	"imi/college/internal/writer"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// column of another table holding ids of dictionary entries
+type reference struct {
+	table  string
+	column string
+}
+
+type dictionaryBody interface {
+	// id of the new entry, nil if it's generated by the database
+	entryID() (any, error)
+}
+
+type DictEntryBody struct {
+	ID           int     `json:"id" validate:"omitempty,gt=0"`
+	Value        string  `json:"value" validate:"required"`
+	DisplayValue *string `json:"displayValue" validate:"omitnil,gte=1"`
+}
+
+func (b DictEntryBody) entryID() (any, error) {
+	if b.ID == 0 {
+		return nil, httpx.BadRequest("id is required for new entries")
+	}
+	return b.ID, nil
+}
+
+type DictRegionBody struct {
+	DictEntryBody
+	RegionID     int `json:"regionId" validate:"required"`
+	SortPriority int `json:"sortPriority"`
+}
+
+type DictNationalityBody struct {
+	DictEntryBody
+	SortPriority int `json:"sortPriority"`
+}
+
+type DictAppStatusBody struct {
+	DictEntryBody
+	IsDefault bool `json:"isDefault"`
+}
+
+type MajorEntranceTestBody struct {
+	Name     string `json:"name" validate:"required"`
+	MinScore *int   `json:"minScore" validate:"omitnil,gte=0"`
+}
+
+type CollegeMajorBody struct {
+	Name   string `json:"name" validate:"required"`
+	Prefix string `json:"prefix" validate:"required"`
+	// Deprecated: set EduLevelID, base is filled in from the level if omitted
+	Base           string                  `json:"base"`
+	NameOfficial   string                  `json:"nameOfficial" validate:"required"`
+	Budget         bool                    `json:"budget"`
+	Code           string                  `json:"code" validate:"required"`
+	EduLevelID     int                     `json:"eduLevelId" validate:"required"`
+	StudyForm      string                  `json:"studyForm" validate:"required,oneof=full-time part-time distance"`
+	DurationMonths int                     `json:"durationMonths" validate:"required,gt=0"`
+	Qualification  string                  `json:"qualification" validate:"required"`
+	TuitionCost    *int64                  `json:"tuitionCost" validate:"omitnil,gt=0"`
+	Description    string                  `json:"description"`
+	EntranceTests  []MajorEntranceTestBody `json:"entranceTests" validate:"dive"`
+}
+
+func (b CollegeMajorBody) entryID() (any, error) {
+	return nil, nil
+}
+
+// admin operations shared by every dictionary
+type dictionaryAdmin interface {
+	permission() int64
+	create(tx *gorm.DB, r *http.Request) (any, error)
+	update(tx *gorm.DB, r *http.Request, id any) (any, error)
+	setRetired(tx *gorm.DB, id any, retired bool) error
+	delete(tx *gorm.DB, id any) error
+	exists(tx *gorm.DB, id any) (bool, error)
+	parseID(raw string) (any, error)
+}
+
+type dictionary[T any, B dictionaryBody] struct {
+	required   int64
+	references []reference
+	// fills the entry from the body, id is nil for entries
+	// whose ids are generated by the database
+	apply func(entry *T, id any, body B)
+	// optional, called once the entry is saved
+	afterSave func(tx *gorm.DB, entry *T) error
+	uuidIDs   bool
+}
+
+func (d dictionary[T, B]) permission() int64 {
+	return d.required
+}
+
+func (d dictionary[T, B]) parseID(raw string) (any, error) {
+	if d.uuidIDs {
+		return uuid.Parse(raw)
+	}
+	return strconv.Atoi(raw)
+}
+
+func decodeDictionaryBody[B any](r *http.Request) (B, error) {
+	var body B
+
+	if !checks.IsJson(r) {
+		return body, httpx.MalformedJSON()
+	}
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return body, httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return body, httpx.InvalidRequest(cause)
+		}
+		return body, err
+	}
+
+	return body, nil
+}
+
+func dictionaryWriteError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return httpx.BadRequest("entry with this id or value already exists")
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return httpx.BadRequest("entry references a missing entry of another dictionary")
+	case errors.Is(err, gorm.ErrCheckConstraintViolated):
+		return httpx.BadRequest("entry has invalid values")
+	}
+	return err
+}
+
+// associations of the entry are left to afterSave
+func (d dictionary[T, B]) save(tx *gorm.DB, entry *T) error {
+	if err := tx.Omit(clause.Associations).Save(entry).Error; err != nil {
+		return dictionaryWriteError(err)
+	}
+
+	if d.afterSave != nil {
+		return d.afterSave(tx, entry)
+	}
+
+	return nil
+}
+
+func (d dictionary[T, B]) create(tx *gorm.DB, r *http.Request) (any, error) {
+	body, err := decodeDictionaryBody[B](r)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := body.entryID()
+	if err != nil {
+		return nil, err
+	}
+
+	var entry T
+	d.apply(&entry, id, body)
+
+	if id != nil {
+		var count int64
+
+		if err := tx.Model(new(T)).Where("id = ?", id).Count(&count).Error; err != nil {
+			return nil, err
+		}
+
+		if count > 0 {
+			return nil, httpx.BadRequest("entry with this id already exists")
+		}
+	}
+
+	if err := tx.Omit(clause.Associations).Create(&entry).Error; err != nil {
+		return nil, dictionaryWriteError(err)
+	}
+
+	if d.afterSave != nil {
+		if err := d.afterSave(tx, &entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+func (d dictionary[T, B]) update(tx *gorm.DB, r *http.Request, id any) (any, error) {
+	body, err := decodeDictionaryBody[B](r)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry T
+
+	if err := tx.Where("id = ?", id).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, httpx.NotFound()
+		}
+		return nil, err
+	}
+
+	d.apply(&entry, id, body)
+
+	if err := d.save(tx, &entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// refuses missing and retired entries, new rows can't reference them
+func requireAvailable(tx *gorm.DB, model any, id any, name string) error {
+	var available int64
+
+	if err := tx.Model(model).Where("id = ? AND retired_at IS NULL", id).Count(&available).Error; err != nil {
+		return err
+	}
+
+	if available == 0 {
+		return httpx.BadRequest(name + " is not available")
+	}
+
+	return nil
+}
+
+// retired entries are kept for the rows referencing them,
+// but are no longer offered to clients
+func (d dictionary[T, B]) setRetired(tx *gorm.DB, id any, retired bool) error {
+	var retiredAt *time.Time
+	if retired {
+		now := time.Now()
+		retiredAt = &now
+	}
+
+	result := tx.Model(new(T)).Where("id = ?", id).Update("retired_at", retiredAt)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return httpx.NotFound()
+	}
+
+	return nil
+}
+
+// referenced entries are never deleted, as deletion would
+// cascade to the rows referencing them
+func (d dictionary[T, B]) delete(tx *gorm.DB, id any) error {
+	for _, ref := range d.references {
+		var count int64
+
+		if err := tx.Table(ref.table).Where(fmt.Sprintf("%s = ?", ref.column), id).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count > 0 {
+			return httpx.DictionaryEntryInUse()
+		}
+	}
+
+	result := tx.Where("id = ?", id).Delete(new(T))
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return httpx.NotFound()
+	}
+
+	return nil
+}
+
+func (d dictionary[T, B]) exists(tx *gorm.DB, id any) (bool, error) {
+	var count int64
+
+	if err := tx.Model(new(T)).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func applyDictEntry(id any, body DictEntryBody, entryID *int, value *string, displayValue **string) {
+	if id != nil {
+		*entryID = id.(int)
+	}
+	*value = body.Value
+	*displayValue = body.DisplayValue
+}
+
+// base of majors is kept for older clients, they get
+// the display value of the major's education level
+func fillMajorBase(tx *gorm.DB, entry *models.CollegeMajor) error {
+	var level models.DictEduLevel
+
+	if err := tx.Where("id = ?", *entry.EduLevelID).First(&level).Error; err != nil {
+		return err
+	}
+
+	entry.Base = level.Value
+	if level.DisplayValue != nil {
+		entry.Base = *level.DisplayValue
+	}
+
+	return tx.Model(entry).UpdateColumn("base", entry.Base).Error
+}
+
+var dictionaryAdmins = map[string]dictionaryAdmin{
+	dictionaries.TownTypes: dictionary[models.DictTownType, DictEntryBody]{
+		required:   permissions.PermissionEditDictionaries,
+		references: []reference{{"user_addresses", "town_type_id"}, {"dict_settlements", "town_type_id"}},
+		apply: func(entry *models.DictTownType, id any, body DictEntryBody) {
+			applyDictEntry(id, body, &entry.ID, &entry.Value, &entry.DisplayValue)
+		},
+	},
+	dictionaries.Regions: dictionary[models.DictRegion, DictRegionBody]{
+		required:   permissions.PermissionEditDictionaries,
+		references: []reference{{"user_addresses", "region_id"}, {"education_docs", "issuer_region_id"}, {"dict_settlements", "region_id"}},
+		apply: func(entry *models.DictRegion, id any, body DictRegionBody) {
+			applyDictEntry(id, body.DictEntryBody, &entry.ID, &entry.Value, &entry.DisplayValue)
+			entry.RegionID = body.RegionID
+			entry.SortPriority = body.SortPriority
+		},
+	},
+	dictionaries.Genders: dictionary[models.DictGender, DictEntryBody]{
+		required:   permissions.PermissionEditDictionaries,
+		references: []reference{{"user_details", "gender_id"}},
+		apply: func(entry *models.DictGender, id any, body DictEntryBody) {
+			applyDictEntry(id, body, &entry.ID, &entry.Value, &entry.DisplayValue)
+		},
+	},
+	dictionaries.EduLevels: dictionary[models.DictEduLevel, DictEntryBody]{
+		required:   permissions.PermissionEditDictionaries,
+		references: []reference{{"applications", "edu_level_id"}, {"college_majors", "edu_level_id"}},
+		apply: func(entry *models.DictEduLevel, id any, body DictEntryBody) {
+			applyDictEntry(id, body, &entry.ID, &entry.Value, &entry.DisplayValue)
+		},
+	},
+	dictionaries.AppStatuses: dictionary[models.DictAppStatus, DictAppStatusBody]{
+		required:   permissions.PermissionEditDictionaries,
+		references: []reference{{"applications", "status_id"}, {"archived_applications", "status_id"}},
+		apply: func(entry *models.DictAppStatus, id any, body DictAppStatusBody) {
+			applyDictEntry(id, body.DictEntryBody, &entry.ID, &entry.Value, &entry.DisplayValue)
+			entry.IsDefault = body.IsDefault
+		},
+		// only one status can be given to new applications
+		afterSave: func(tx *gorm.DB, entry *models.DictAppStatus) error {
+			if !entry.IsDefault {
+				return nil
+			}
+			return tx.Model(&models.DictAppStatus{}).Where("id <> ?", entry.ID).Update("is_default", false).Error
+		},
+	},
+	dictionaries.IdDocTypes: dictionary[models.DictIdDocType, DictEntryBody]{
+		required:   permissions.PermissionEditDictionaries,
+		references: []reference{{"identity_docs", "type_id"}, {"guardians", "doc_type_id"}},
+		apply: func(entry *models.DictIdDocType, id any, body DictEntryBody) {
+			applyDictEntry(id, body, &entry.ID, &entry.Value, &entry.DisplayValue)
+		},
+	},
+	dictionaries.EduDocTypes: dictionary[models.DictEduDocType, DictEntryBody]{
+		required:   permissions.PermissionEditDictionaries,
+		references: []reference{{"education_docs", "type_id"}},
+		apply: func(entry *models.DictEduDocType, id any, body DictEntryBody) {
+			applyDictEntry(id, body, &entry.ID, &entry.Value, &entry.DisplayValue)
+		},
+	},
+	dictionaries.Nationalities: dictionary[models.DictNationality, DictNationalityBody]{
+		required:   permissions.PermissionEditDictionaries,
+		references: []reference{{"identity_docs", "nationality_id"}},
+		apply: func(entry *models.DictNationality, id any, body DictNationalityBody) {
+			applyDictEntry(id, body.DictEntryBody, &entry.ID, &entry.Value, &entry.DisplayValue)
+			entry.SortPriority = body.SortPriority
+		},
+	},
+	dictionaries.Majors: dictionary[models.CollegeMajor, CollegeMajorBody]{
+		required:   permissions.PermissionEditMajors,
+		references: []reference{{"applications", "major_id"}, {"archived_applications", "major_id"}, {"staff_scopes", "major_id"}},
+		apply: func(entry *models.CollegeMajor, id any, body CollegeMajorBody) {
+			if id != nil {
+				entry.ID = id.(uuid.UUID)
+			}
+			entry.Name = body.Name
+			entry.Prefix = body.Prefix
+			entry.Base = body.Base
+			entry.NameOfficial = body.NameOfficial
+			entry.Budget = body.Budget
+			entry.Code = body.Code
+			entry.EduLevelID = &body.EduLevelID
+			entry.StudyForm = body.StudyForm
+			entry.DurationMonths = &body.DurationMonths
+			entry.Qualification = &body.Qualification
+			entry.TuitionCost = body.TuitionCost
+			entry.Description = body.Description
+
+			entry.EntranceTests = make([]models.MajorEntranceTest, len(body.EntranceTests))
+			for i, test := range body.EntranceTests {
+				entry.EntranceTests[i] = models.MajorEntranceTest{Position: i, Name: test.Name, MinScore: test.MinScore}
+			}
+		},
+		// the entry's tests replace the ones it had before
+		afterSave: func(tx *gorm.DB, entry *models.CollegeMajor) error {
+			if len(entry.Base) == 0 && entry.EduLevelID != nil {
+				if err := fillMajorBase(tx, entry); err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Where(&models.MajorEntranceTest{MajorID: entry.ID}).Delete(&models.MajorEntranceTest{}).Error; err != nil {
+				return err
+			}
+
+			if len(entry.EntranceTests) == 0 {
+				return nil
+			}
+
+			for i := range entry.EntranceTests {
+				entry.EntranceTests[i].MajorID = entry.ID
+			}
+
+			return tx.Create(&entry.EntranceTests).Error
+		},
+		uuidIDs: true,
+	},
+}
+
+// resolves the dictionary from the path and makes sure
+// the current user is allowed to change it
+func getDictionaryAdmin(db *gorm.DB, r *http.Request) (string, dictionaryAdmin, error) {
+	name := chi.URLParam(r, "dictionary")
+
+	admin, ok := dictionaryAdmins[name]
+	if !ok {
+		return "", nil, httpx.NotFound()
+	}
+
+	user, err := ctx.GetCurrentUser(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !permissions.HasPermissions(user.EffectivePermissions(), admin.permission()) {
+		return "", nil, httpx.Forbidden()
+	}
+
+	if err := httpx.CheckStaffTwoFactor(db, user); err != nil {
+		return "", nil, err
+	}
+
+	return name, admin, nil
+}
+
+func getDictionaryEntryID(r *http.Request, admin dictionaryAdmin) (any, error) {
+	id, err := admin.parseID(chi.URLParam(r, "entryId"))
+	if err != nil {
+		return nil, httpx.UnprocessableEntity()
+	}
+	return id, nil
+}
+
+// POST /dictionaries/{dictionary}
+func (h *DictionariesHandler) Create(w http.ResponseWriter, r *http.Request) error {
+	name, admin, err := getDictionaryAdmin(h.db, r)
+	if err != nil {
+		return err
+	}
+
+	var entry any
+
+	txFn := func(tx *gorm.DB) error {
+		var err error
+
+		if entry, err = admin.create(tx, r); err != nil {
+			return err
+		}
+
+		return dictionaries.Bump(tx, name)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	// entries can appear in other dictionaries' responses, e.g.
+	// regions of towns, so every cached response is dropped
+	h.cache.Clear()
+
+	return writer.JSON(w, http.StatusOK, entry)
+}
+
+// PUT /dictionaries/{dictionary}/{entryId}
+func (h *DictionariesHandler) Update(w http.ResponseWriter, r *http.Request) error {
+	name, admin, err := getDictionaryAdmin(h.db, r)
+	if err != nil {
+		return err
+	}
+
+	id, err := getDictionaryEntryID(r, admin)
+	if err != nil {
+		return err
+	}
+
+	var entry any
+
+	txFn := func(tx *gorm.DB) error {
+		var err error
+
+		if entry, err = admin.update(tx, r, id); err != nil {
+			return err
+		}
+
+		return dictionaries.Bump(tx, name)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	h.cache.Clear()
+
+	return writer.JSON(w, http.StatusOK, entry)
+}
+
+func (h *DictionariesHandler) setRetired(w http.ResponseWriter, r *http.Request, retired bool) error {
+	name, admin, err := getDictionaryAdmin(h.db, r)
+	if err != nil {
+		return err
+	}
+
+	id, err := getDictionaryEntryID(r, admin)
+	if err != nil {
+		return err
+	}
+
+	txFn := func(tx *gorm.DB) error {
+		if err := admin.setRetired(tx, id, retired); err != nil {
+			return err
+		}
+
+		return dictionaries.Bump(tx, name)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	h.cache.Clear()
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"retired": retired})
+}
+
+// POST /dictionaries/{dictionary}/{entryId}/retire
+func (h *DictionariesHandler) Retire(w http.ResponseWriter, r *http.Request) error {
+	return h.setRetired(w, r, true)
+}
+
+// POST /dictionaries/{dictionary}/{entryId}/restore
+func (h *DictionariesHandler) Restore(w http.ResponseWriter, r *http.Request) error {
+	return h.setRetired(w, r, false)
+}
+
+// DELETE /dictionaries/{dictionary}/{entryId}
+func (h *DictionariesHandler) Delete(w http.ResponseWriter, r *http.Request) error {
+	name, admin, err := getDictionaryAdmin(h.db, r)
+	if err != nil {
+		return err
+	}
+
+	id, err := getDictionaryEntryID(r, admin)
+	if err != nil {
+		return err
+	}
+
+	txFn := func(tx *gorm.DB) error {
+		if err := admin.delete(tx, id); err != nil {
+			return err
+		}
+
+		if err := tx.Where(&models.DictTranslation{Dictionary: name, EntryID: dictionaries.EntryID(id)}).Delete(&models.DictTranslation{}).Error; err != nil {
+			return err
+		}
+
+		return dictionaries.Bump(tx, name)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	h.cache.Clear()
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
+
+type DictTranslationBody struct {
+	DisplayValue string `json:"displayValue" validate:"required"`
+}
+
+// resolves the entry and the locale of a translation from the path
+func getDictionaryTranslation(db *gorm.DB, r *http.Request) (string, string, string, error) {
+	name, admin, err := getDictionaryAdmin(db, r)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	id, err := getDictionaryEntryID(r, admin)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	exists, err := admin.exists(db, id)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if !exists {
+		return "", "", "", httpx.NotFound()
+	}
+
+	locale := chi.URLParam(r, "locale")
+	if len(locale) > 0 && !dictionaries.IsLocale(locale) {
+		return "", "", "", httpx.BadRequest(fmt.Sprintf("locale must be one of %v", dictionaries.Locales))
+	}
+
+	return name, dictionaries.EntryID(id), locale, nil
+}
+
+// GET /dictionaries/{dictionary}/{entryId}/translations
+func (h *DictionariesHandler) ReadTranslations(w http.ResponseWriter, r *http.Request) error {
+	name, entryID, _, err := getDictionaryTranslation(h.db, r)
+	if err != nil {
+		return err
+	}
+
+	translations, err := dictionaries.GetTranslations(h.db, name, entryID)
+	if err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, translations)
+}
+
+// PUT /dictionaries/{dictionary}/{entryId}/translations/{locale}
+func (h *DictionariesHandler) PutTranslation(w http.ResponseWriter, r *http.Request) error {
+	name, entryID, locale, err := getDictionaryTranslation(h.db, r)
+	if err != nil {
+		return err
+	}
+
+	body, err := decodeDictionaryBody[DictTranslationBody](r)
+	if err != nil {
+		return err
+	}
+
+	translation := models.DictTranslation{
+		Dictionary:   name,
+		EntryID:      entryID,
+		Locale:       locale,
+		DisplayValue: body.DisplayValue,
+	}
+
+	txFn := func(tx *gorm.DB) error {
+		if err := tx.Save(&translation).Error; err != nil {
+			return err
+		}
+
+		return dictionaries.Bump(tx, name)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	h.cache.Clear()
+
+	return writer.JSON(w, http.StatusOK, translation)
+}
+
+// DELETE /dictionaries/{dictionary}/{entryId}/translations/{locale}
+func (h *DictionariesHandler) DeleteTranslation(w http.ResponseWriter, r *http.Request) error {
+	name, entryID, locale, err := getDictionaryTranslation(h.db, r)
+	if err != nil {
+		return err
+	}
+
+	txFn := func(tx *gorm.DB) error {
+		result := tx.Delete(&models.DictTranslation{Dictionary: name, EntryID: entryID, Locale: locale})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return httpx.NotFound()
+		}
+
+		return dictionaries.Bump(tx, name)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	h.cache.Clear()
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"imi/college/internal/history"
 	"imi/college/internal/httpx"
 	"imi/college/internal/models"
 	"imi/college/internal/permissions"
@@ -21,7 +22,7 @@ type EducationDocsHandler struct {
 
 // GET /users/{userId}/documents/education
 func (h *EducationDocsHandler) Read(w http.ResponseWriter, r *http.Request) error {
-	_, targerUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewUser)
+	_, targerUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewDocuments)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return httpx.NotFound()
@@ -50,7 +51,7 @@ type EducationDocBody struct {
 
 // POST /users/{userId}/documents/education
 func (h *EducationDocsHandler) Create(w http.ResponseWriter, r *http.Request) error {
-	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditDocuments)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return httpx.NotFound()
@@ -88,7 +89,31 @@ func (h *EducationDocsHandler) Create(w http.ResponseWriter, r *http.Request) er
 		IssuerRegionID: body.IssuerRegionID,
 	}
 
-	if err := h.db.Create(&newDoc).Error; err != nil {
+	actorID := httpx.GetActorID(r, currentUser)
+
+	txFn := func(tx *gorm.DB) error {
+		if err := requireAvailable(tx, &models.DictEduDocType{}, body.TypeID, "document type"); err != nil {
+			return err
+		}
+
+		if err := requireAvailable(tx, &models.DictRegion{}, body.IssuerRegionID, "region"); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&newDoc).Error; err != nil {
+			return err
+		}
+
+		return history.Record(tx, history.Change{
+			ActorID:  &actorID,
+			OwnerID:  targetUser.ID,
+			Entity:   history.EntityEducationDoc,
+			EntityID: newDoc.ID,
+			After:    newDoc,
+		})
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
 		return err
 	}
 
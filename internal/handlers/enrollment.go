@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"imi/college/internal/checks"
+	"imi/college/internal/ctx"
+	"imi/college/internal/history"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/query"
+	"imi/college/internal/types/date"
+	"imi/college/internal/validation"
+	"imi/college/internal/writer"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type EnrollmentOrdersHandler struct {
+	db *gorm.DB
+}
+
+type EnrollmentOrderBody struct {
+	Number         string      `json:"number" validate:"required"`
+	IssuedAt       date.Date   `json:"issuedAt" validate:"required"`
+	ApplicationIDs []uuid.UUID `json:"applicationIds" validate:"required,min=1"`
+}
+
+type EnrollmentOrderResponse struct {
+	models.EnrollmentOrder
+	Applications []models.Application `json:"applications"`
+}
+
+// POST /enrollment-orders
+//
+// issues an order enrolling applicants by the listed applications,
+// enrolled users are kept from erasure unless an admin overrides it
+func (h *EnrollmentOrdersHandler) Create(w http.ResponseWriter, r *http.Request) error {
+	if !checks.IsJson(r) {
+		return httpx.MalformedJSON()
+	}
+
+	currentUser, err := ctx.GetCurrentUser(r)
+	if err != nil {
+		return err
+	}
+
+	var body EnrollmentOrderBody
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return httpx.InvalidRequest(cause)
+		}
+		return err
+	}
+
+	slices.SortFunc(body.ApplicationIDs, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+	body.ApplicationIDs = slices.Compact(body.ApplicationIDs)
+
+	response := EnrollmentOrderResponse{
+		EnrollmentOrder: models.EnrollmentOrder{Number: body.Number, IssuedAt: body.IssuedAt},
+	}
+
+	actorID := httpx.GetActorID(r, currentUser)
+
+	txFn := func(tx *gorm.DB) error {
+		var apps []models.Application
+
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND enrollment_order_id IS NULL", body.ApplicationIDs).
+			Find(&apps).
+			Error; err != nil {
+			return err
+		}
+
+		if len(apps) != len(body.ApplicationIDs) {
+			return httpx.BadRequest("some of the applications do not exist or are already enrolled")
+		}
+
+		// staff limited to certain majors only enroll applicants to them
+		if !permissions.HasAdmin(currentUser.EffectivePermissions()) {
+			majors, err := query.GetStaffScopeMajorIDs(tx, currentUser.ID)
+			if err != nil {
+				return err
+			}
+
+			for _, app := range apps {
+				if len(majors) > 0 && !slices.Contains(majors, app.MajorID) {
+					return httpx.Forbidden()
+				}
+			}
+		}
+
+		if err := tx.Create(&response.EnrollmentOrder).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return httpx.BadRequest("order with this number already exists")
+			}
+			return err
+		}
+
+		for i, before := range apps {
+			apps[i].EnrollmentOrderID = &response.ID
+
+			if err := tx.Model(&apps[i]).UpdateColumn("enrollment_order_id", response.ID).Error; err != nil {
+				return err
+			}
+
+			if err := history.Record(tx, history.Change{
+				ActorID:  &actorID,
+				OwnerID:  before.UserID,
+				Entity:   history.EntityApplication,
+				EntityID: before.ID,
+				Before:   before,
+				After:    apps[i],
+			}); err != nil {
+				return err
+			}
+		}
+
+		response.Applications = apps
+
+		return nil
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, response)
+}
+
+// GET /enrollment-orders/{orderId}
+func (h *EnrollmentOrdersHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	id, err := uuid.Parse(chi.URLParam(r, "orderId"))
+	if err != nil {
+		return httpx.NotFound()
+	}
+
+	var response EnrollmentOrderResponse
+
+	if err := h.db.Where("id = ?", id).First(&response.EnrollmentOrder).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	if err := h.db.Where(&models.Application{EnrollmentOrderID: &id}).Order("created_at").Find(&response.Applications).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"imi/college/internal/export"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/writer"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// staff need to be able to see every part of the user's data
+const exportPermissions = permissions.PermissionViewUser | permissions.PermissionViewDocuments | permissions.PermissionViewApplications
+
+type ExportHandler struct {
+	db       *gorm.DB
+	exporter *export.Exporter
+}
+
+type ExportJobResponse struct {
+	models.ExportJob
+	DownloadURL string `json:"downloadUrl"`
+}
+
+func exportFilename(userID uuid.UUID) string {
+	return fmt.Sprintf("export-%s.zip", userID)
+}
+
+// GET /users/{userId}/export
+//
+// responds with a ZIP archive of everything stored about the user;
+// large accounts, or any account with ?async=true, are exported in
+// the background and the response points at where to download it
+func (h *ExportHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", exportPermissions)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	size, err := export.Size(targetUser.ID)
+	if err != nil {
+		return err
+	}
+
+	if size > export.SyncLimit || r.URL.Query().Get("async") == "true" {
+		job, err := h.exporter.Start(targetUser.ID)
+		if err != nil {
+			return err
+		}
+
+		return writer.JSON(w, http.StatusAccepted, ExportJobResponse{
+			ExportJob:   job,
+			DownloadURL: fmt.Sprintf("/users/%s/export/%s", targetUser.ID, job.ID),
+		})
+	}
+
+	bundle, err := export.Collect(h.db, targetUser.ID)
+	if err != nil {
+		return err
+	}
+
+	// the archive is built before anything is sent, so a failure is still
+	// reported as an error instead of cutting the archive short
+	var archive bytes.Buffer
+
+	if err := export.Write(&archive, bundle); err != nil {
+		return err
+	}
+
+	writer.SetAttachment(w, "application/zip", exportFilename(targetUser.ID))
+	w.Header().Set("Content-Length", strconv.Itoa(archive.Len()))
+
+	_, err = archive.WriteTo(w)
+	return err
+}
+
+// GET /users/{userId}/export/{jobId}
+//
+// responds with the prepared ZIP archive, or with the job
+// itself while the archive is still being prepared
+func (h *ExportHandler) Download(w http.ResponseWriter, r *http.Request) error {
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", exportPermissions)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	jobID, err := uuid.Parse(chi.URLParam(r, "jobId"))
+	if err != nil {
+		return httpx.UnprocessableEntity()
+	}
+
+	var job models.ExportJob
+
+	if err := h.db.Where(&models.ExportJob{ID: jobID, UserID: targetUser.ID}).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	if job.Failed {
+		return httpx.APIError{Status: http.StatusInternalServerError, Message: "The export has failed, request a new one"}
+	}
+
+	archive, err := h.exporter.Open(job)
+	if err != nil {
+		switch {
+		case errors.Is(err, export.ErrNotReady):
+			return writer.JSON(w, http.StatusAccepted, ExportJobResponse{
+				ExportJob:   job,
+				DownloadURL: r.URL.Path,
+			})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	writer.SetAttachment(w, "application/zip", exportFilename(targetUser.ID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+
+	_, err = w.Write(archive)
+	return err
+}
@@ -1,9 +1,9 @@
 package handlers
 
 import (
-	"fmt"
 	"imi/college/internal/ctx"
 	"imi/college/internal/httpx"
+	"imi/college/internal/uploads"
 	"imi/college/internal/writer"
 	"io"
 	"mime/multipart"
@@ -43,8 +43,8 @@ func ValidateImageType(file multipart.File) (string, error) {
 }
 
 func SaveUserImage(image multipart.File, userID uuid.UUID, filename string) error {
-	baseDir := ".file-uploads"
-	userDir := fmt.Sprintf("%s/%s", baseDir, userID)
+	baseDir := uploads.BaseDir
+	userDir := uploads.UserDir(userID)
 
 	if _, err := image.Seek(0, io.SeekStart); err != nil {
 		return err
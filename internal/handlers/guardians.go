@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"imi/college/internal/checks"
+	"imi/college/internal/history"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/types/date"
+	"imi/college/internal/validation"
+	"imi/college/internal/writer"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type GuardiansHandler struct {
+	db *gorm.DB
+}
+
+type GuardianBody struct {
+	FirstName    string    `json:"firstName" validate:"required,gte=2"`
+	MiddleName   string    `json:"middleName" validate:"required,gte=2"`
+	LastName     *string   `json:"lastName" validate:"omitnil,gte=2"`
+	Relationship string    `json:"relationship" validate:"required,oneof=mother father adoptive-parent tutor trustee"`
+	Tel          string    `json:"tel" validate:"required,e164"`
+	Email        *string   `json:"email" validate:"omitnil,email"`
+	DocTypeID    int       `json:"docTypeId" validate:"required"`
+	DocSeries    string    `json:"docSeries" validate:"required,gte=2"`
+	DocNumber    string    `json:"docNumber" validate:"required,gte=2"`
+	DocIssuer    string    `json:"docIssuer" validate:"required,gte=2"`
+	DocIssuedAt  date.Date `json:"docIssuedAt" validate:"required"`
+}
+
+func decodeGuardianBody(r *http.Request) (GuardianBody, error) {
+	if !checks.IsJson(r) {
+		return GuardianBody{}, httpx.MalformedJSON()
+	}
+
+	var body GuardianBody
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return GuardianBody{}, httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return GuardianBody{}, httpx.InvalidRequest(cause)
+		}
+		return GuardianBody{}, err
+	}
+
+	if body.Email != nil {
+		email := validation.NormalizeEmail(*body.Email)
+		body.Email = &email
+	}
+
+	return body, nil
+}
+
+func (b GuardianBody) apply(guardian *models.Guardian) {
+	guardian.FirstName = b.FirstName
+	guardian.MiddleName = b.MiddleName
+	guardian.LastName = b.LastName
+	guardian.Relationship = b.Relationship
+	guardian.Tel = b.Tel
+	guardian.Email = b.Email
+	guardian.DocTypeID = b.DocTypeID
+	guardian.DocSeries = b.DocSeries
+	guardian.DocNumber = b.DocNumber
+	guardian.DocIssuer = b.DocIssuer
+	guardian.DocIssuedAt = b.DocIssuedAt
+}
+
+// looks up the guardian of the user by the id from the path
+func getGuardianFromPath(db *gorm.DB, r *http.Request, userID uuid.UUID) (models.Guardian, error) {
+	guardianID, err := uuid.Parse(chi.URLParam(r, "guardianId"))
+	if err != nil {
+		return models.Guardian{}, httpx.UnprocessableEntity()
+	}
+
+	var guardian models.Guardian
+
+	if err := db.Where(&models.Guardian{ID: guardianID, UserID: userID}).First(&guardian).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Guardian{}, httpx.NotFound()
+		}
+		return models.Guardian{}, err
+	}
+
+	return guardian, nil
+}
+
+// GET /users/{userId}/guardians
+func (h *GuardiansHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var guardians []models.Guardian
+
+	if err := h.db.Where(&models.Guardian{UserID: targetUser.ID}).Order("created_at ASC").Find(&guardians).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, guardians)
+}
+
+// POST /users/{userId}/guardians
+func (h *GuardiansHandler) Create(w http.ResponseWriter, r *http.Request) error {
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	body, err := decodeGuardianBody(r)
+	if err != nil {
+		return err
+	}
+
+	guardian := models.Guardian{UserID: targetUser.ID}
+	body.apply(&guardian)
+
+	actorID := httpx.GetActorID(r, currentUser)
+
+	txFn := func(tx *gorm.DB) error {
+		if err := requireAvailable(tx, &models.DictIdDocType{}, body.DocTypeID, "document type"); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&guardian).Error; err != nil {
+			return err
+		}
+
+		return history.Record(tx, history.Change{
+			ActorID:  &actorID,
+			OwnerID:  targetUser.ID,
+			Entity:   history.EntityGuardian,
+			EntityID: guardian.ID,
+			After:    guardian,
+		})
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, guardian)
+}
+
+// PUT /users/{userId}/guardians/{guardianId}
+func (h *GuardiansHandler) Update(w http.ResponseWriter, r *http.Request) error {
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	body, err := decodeGuardianBody(r)
+	if err != nil {
+		return err
+	}
+
+	var guardian models.Guardian
+
+	actorID := httpx.GetActorID(r, currentUser)
+
+	txFn := func(tx *gorm.DB) error {
+		before, err := getGuardianFromPath(tx, r, targetUser.ID)
+		if err != nil {
+			return err
+		}
+
+		// guardians keep document types retired after they were added
+		if body.DocTypeID != before.DocTypeID {
+			if err := requireAvailable(tx, &models.DictIdDocType{}, body.DocTypeID, "document type"); err != nil {
+				return err
+			}
+		}
+
+		guardian = before
+		body.apply(&guardian)
+
+		if err := tx.Save(&guardian).Error; err != nil {
+			return err
+		}
+
+		return history.Record(tx, history.Change{
+			ActorID:  &actorID,
+			OwnerID:  targetUser.ID,
+			Entity:   history.EntityGuardian,
+			EntityID: guardian.ID,
+			Before:   before,
+			After:    guardian,
+		})
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, guardian)
+}
+
+// DELETE /users/{userId}/guardians/{guardianId}
+func (h *GuardiansHandler) Delete(w http.ResponseWriter, r *http.Request) error {
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var guardian models.Guardian
+
+	actorID := httpx.GetActorID(r, currentUser)
+
+	txFn := func(tx *gorm.DB) error {
+		var err error
+
+		guardian, err = getGuardianFromPath(tx, r, targetUser.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&guardian).Error; err != nil {
+			return err
+		}
+
+		return history.Record(tx, history.Change{
+			ActorID:  &actorID,
+			OwnerID:  targetUser.ID,
+			Entity:   history.EntityGuardian,
+			EntityID: guardian.ID,
+			Before:   guardian,
+		})
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, guardian)
+}
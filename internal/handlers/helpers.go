@@ -1,6 +1,11 @@
 package handlers
 
 import (
+	"imi/college/internal/attempts"
+	"imi/college/internal/erasure"
+	"imi/college/internal/export"
+	"imi/college/internal/sessions"
+
 	"gorm.io/gorm"
 )
 
@@ -13,27 +18,55 @@ type HandlersMap struct {
 	Identities   IdentityDocsHanlder
 	Documents    HandlersDocuments
 	Applications ApplicationsHandler
+	TwoFactor    TwoFactorHandler
+	Roles        RolesHandler
+	Scopes       ScopesHandler
+	Audit        AuditHandler
+	History      HistoryHandler
+	Consents     ConsentsHandler
+	Guardians    GuardiansHandler
+	Export       ExportHandler
+	Enrollment   EnrollmentOrdersHandler
 }
 
 type HandlersDocuments struct {
 	Education EducationDocsHandler
 }
 
-func Create(db *gorm.DB) HandlersMap {
+// the exporter is shared with the background cleanup of expired exports
+func Create(db *gorm.DB, signer *sessions.Signer, exporter *export.Exporter) HandlersMap {
 	if db == nil {
 		panic("database connection cannot be null! never! neeeverrrr!!!")
 	}
 
+	// guesses of passwords and second factor codes of
+	// an account share the same budget
+	byUser := attempts.NewTracker(attempts.NewMemoryStore(), attempts.UserPolicy)
+
 	return HandlersMap{
-		Dictionaries: DictionariesHandler{db},
-		Users:        UserHandler{db},
-		Tokens:       TokensHandler{db},
-		Address:      AddressHandler{db},
-		Files:        FilesHandler{db},
-		Identities:   IdentityDocsHanlder{db},
+		Dictionaries: NewDictionariesHandler(db),
+		Users:        UserHandler{db, signer, erasure.New(db, signer)},
+		Tokens: TokensHandler{
+			db:     db,
+			signer: signer,
+			byUser: byUser,
+			byIP:   attempts.NewTracker(attempts.NewMemoryStore(), attempts.IPPolicy),
+		},
+		Address:    AddressHandler{db},
+		Files:      FilesHandler{db},
+		Identities: IdentityDocsHanlder{db},
 		Documents: HandlersDocuments{
 			Education: EducationDocsHandler{db},
 		},
 		Applications: ApplicationsHandler{db},
+		TwoFactor:    TwoFactorHandler{db, byUser},
+		Roles:        RolesHandler{db, signer},
+		Scopes:       ScopesHandler{db},
+		Audit:        AuditHandler{db},
+		History:      HistoryHandler{db},
+		Consents:     ConsentsHandler{db},
+		Guardians:    GuardiansHandler{db},
+		Export:       ExportHandler{db, exporter},
+		Enrollment:   EnrollmentOrdersHandler{db},
 	}
 }
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"imi/college/internal/history"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/writer"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type HistoryHandler struct {
+	db *gorm.DB
+}
+
+// permissions needed to see the history of the entity kind,
+// without a kind all of them are needed
+func historyPermissions(entity string) int64 {
+	switch entity {
+	case history.EntityDetails, history.EntityAddress, history.EntityGuardian:
+		return permissions.PermissionViewUser
+	case history.EntityIdentityDoc, history.EntityEducationDoc:
+		return permissions.PermissionViewDocuments
+	case history.EntityApplication:
+		return permissions.PermissionViewApplications
+	default:
+		return permissions.PermissionViewUser | permissions.PermissionViewDocuments | permissions.PermissionViewApplications
+	}
+}
+
+// GET /users/{userId}/history
+//
+// timeline of changes made to the user's data, oldest first;
+// can be narrowed down with entity and entityId
+func (h *HistoryHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	params := r.URL.Query()
+
+	entity := params.Get("entity")
+	if len(entity) > 0 && !slices.Contains(history.Entities, entity) {
+		return httpx.BadRequest("entity is unknown")
+	}
+
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", historyPermissions(entity))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	q := h.db.Where(&models.ChangeRecord{OwnerID: targetUser.ID, Entity: entity})
+
+	if value := params.Get("entityId"); len(value) > 0 {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return httpx.BadRequest("entityId must be a valid uuid")
+		}
+		q = q.Where(&models.ChangeRecord{EntityID: id})
+	}
+
+	var records []models.ChangeRecord
+
+	if err := q.Order("created_at ASC, id ASC").Find(&records).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, records)
+}
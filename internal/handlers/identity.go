@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"imi/college/internal/checks"
+	"imi/college/internal/history"
 	"imi/college/internal/httpx"
 	"imi/college/internal/models"
 	"imi/college/internal/permissions"
@@ -22,7 +23,7 @@ type IdentityDocsHanlder struct {
 
 // GET /users/{userId}/documents/identity
 func (h *IdentityDocsHanlder) Read(w http.ResponseWriter, r *http.Request) error {
-	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewUser)
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewDocuments)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return httpx.NotFound()
@@ -54,7 +55,7 @@ func (h *IdentityDocsHanlder) Create(w http.ResponseWriter, r *http.Request) err
 		return httpx.BadRequest("JSON body required")
 	}
 
-	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditDocuments)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return httpx.NotFound()
@@ -83,6 +84,8 @@ func (h *IdentityDocsHanlder) Create(w http.ResponseWriter, r *http.Request) err
 
 	var newIdentity models.IdentityDoc
 
+	actorID := httpx.GetActorID(r, currentUser)
+
 	txFn := func(tx *gorm.DB) error {
 		var defaultStatus models.DocStatus
 
@@ -90,6 +93,14 @@ func (h *IdentityDocsHanlder) Create(w http.ResponseWriter, r *http.Request) err
 			return httpx.BadRequest("Default document status is not present")
 		}
 
+		if err := requireAvailable(tx, &models.DictIdDocType{}, body.TypeID, "document type"); err != nil {
+			return err
+		}
+
+		if err := requireAvailable(tx, &models.DictNationality{}, body.NationalityID, "nationality"); err != nil {
+			return err
+		}
+
 		newIdentity = models.IdentityDoc{
 			UserID:        targetUser.ID,
 			StatusID:      defaultStatus.ID,
@@ -102,11 +113,17 @@ func (h *IdentityDocsHanlder) Create(w http.ResponseWriter, r *http.Request) err
 			NationalityID: body.NationalityID,
 		}
 
-		if err := h.db.Create(&newIdentity).Error; err != nil {
+		if err := tx.Create(&newIdentity).Error; err != nil {
 			return err
 		}
 
-		return nil
+		return history.Record(tx, history.Change{
+			ActorID:  &actorID,
+			OwnerID:  targetUser.ID,
+			Entity:   history.EntityIdentityDoc,
+			EntityID: newIdentity.ID,
+			After:    newIdentity,
+		})
 	}
 
 	if err := h.db.Transaction(txFn); err != nil {
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"errors"
+	"imi/college/internal/dictionaries"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/query"
+	"imi/college/internal/writer"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// applicants browse majors before signing up, so the catalogue
+// is public and lists only majors which aren't retired
+var majorsCatalogueListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"name": {Column: "name", Field: "Name"},
+		"code": {Column: "code", Field: "Code"},
+	},
+	DefaultSort: "name",
+	Key:         query.SortField{Column: "id", Field: "ID"},
+	Filters: map[string]query.Filter{
+		"eduLevelId":     {Column: "edu_level_id", Parse: query.ParseInt},
+		"studyForm":      {Column: "study_form", Parse: query.ParseOneOf(models.StudyForms...)},
+		"budget":         {Column: "budget", Parse: query.ParseBool},
+		"paid":           {Column: "(tuition_cost IS NOT NULL)", Parse: query.ParseBool},
+		"maxTuitionCost": {Column: "tuition_cost", Operator: "<=", Parse: query.ParseInt},
+	},
+	DefaultLimit: 50,
+	MaxLimit:     100,
+}
+
+// the catalogue shows majors along with their education levels,
+// so it changes whenever either of the dictionaries does
+func getCatalogueVersion(db *gorm.DB) (models.DictionaryVersion, error) {
+	versions, err := dictionaries.GetVersions(db, []string{dictionaries.Majors, dictionaries.EduLevels})
+	if err != nil {
+		return models.DictionaryVersion{}, err
+	}
+
+	combined := models.DictionaryVersion{Name: dictionaries.Majors}
+
+	for _, version := range versions {
+		combined.Version += version.Version
+
+		if version.UpdatedAt.After(combined.UpdatedAt) {
+			combined.UpdatedAt = version.UpdatedAt
+		}
+	}
+
+	return combined, nil
+}
+
+func preloadMajorDetails(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("EduLevel").
+		Preload("EntranceTests", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		})
+}
+
+// majors get their names translated and their education
+// levels the display values in the locale
+func localizeMajors(db *gorm.DB, locale string, majors []models.CollegeMajor) error {
+	if err := dictionaries.Localize(db, dictionaries.Majors, locale, majors); err != nil {
+		return err
+	}
+
+	var levels []models.DictEduLevel
+	var owners []int
+
+	for i := range majors {
+		if majors[i].EduLevel != nil {
+			levels = append(levels, *majors[i].EduLevel)
+			owners = append(owners, i)
+		}
+	}
+
+	if err := dictionaries.Localize(db, dictionaries.EduLevels, locale, levels); err != nil {
+		return err
+	}
+
+	for j, i := range owners {
+		majors[i].EduLevel = &levels[j]
+	}
+
+	return nil
+}
+
+// GET /majors
+//
+// majors open for applications with their education levels and
+// entrance tests; every word of ?q= has to be found in the name,
+// the official name or the code
+func (h *DictionariesHandler) ReadCatalogue(w http.ResponseWriter, r *http.Request) error {
+	list, err := httpx.ParseList(r, majorsCatalogueListSpec)
+	if err != nil {
+		return err
+	}
+
+	locale := httpx.GetLocale(r, dictionaries.Locales, dictionaries.DefaultLocale)
+
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+
+	build := func() (dictionaryResponse, error) {
+		version, err := getCatalogueVersion(h.db)
+		if err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		q := h.db.Where("retired_at IS NULL")
+
+		for _, word := range strings.Fields(r.URL.Query().Get("q")) {
+			pattern := "%" + query.EscapeLike(word) + "%"
+			q = q.Where("(name ILIKE ? OR name_official ILIKE ? OR code ILIKE ?)", pattern, pattern, pattern)
+		}
+
+		var majors []models.CollegeMajor
+
+		if err := q.Scopes(list.Scope, preloadMajorDetails).Find(&majors).Error; err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		majors, nextCursor, err := query.Paginate(list, majors)
+		if err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		if err := localizeMajors(h.db, locale, majors); err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		return dictionaryResponse{
+			etag:         dictionaryETag(r, version, locale),
+			lastModified: version.UpdatedAt,
+			data:         majors,
+			nextCursor:   nextCursor,
+		}, nil
+	}
+
+	response, err := h.cached(dictionaryCacheKey(r, "catalogue", locale), build)
+	if err != nil {
+		return err
+	}
+
+	if httpx.NotModified(w, r, response.etag, response.lastModified) {
+		return nil
+	}
+
+	return writer.Paginated(w, http.StatusOK, response.data.([]models.CollegeMajor), response.nextCursor)
+}
+
+// GET /majors/{majorId}
+//
+// retired majors are still found, applications might refer to them
+func (h *DictionariesHandler) ReadMajor(w http.ResponseWriter, r *http.Request) error {
+	id, err := uuid.Parse(chi.URLParam(r, "majorId"))
+	if err != nil {
+		return httpx.NotFound()
+	}
+
+	locale := httpx.GetLocale(r, dictionaries.Locales, dictionaries.DefaultLocale)
+
+	w.Header().Set("Content-Language", locale)
+	w.Header().Add("Vary", "Accept-Language")
+
+	build := func() (dictionaryResponse, error) {
+		version, err := getCatalogueVersion(h.db)
+		if err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		majors := make([]models.CollegeMajor, 1)
+
+		if err := h.db.Scopes(preloadMajorDetails).Where("id = ?", id).First(&majors[0]).Error; err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		if err := localizeMajors(h.db, locale, majors); err != nil {
+			return dictionaryResponse{}, err
+		}
+
+		return dictionaryResponse{
+			etag:         dictionaryETag(r, version, locale),
+			lastModified: version.UpdatedAt,
+			data:         majors[0],
+		}, nil
+	}
+
+	response, err := h.cached(dictionaryCacheKey(r, "catalogue/"+id.String(), locale), build)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	if httpx.NotModified(w, r, response.etag, response.lastModified) {
+		return nil
+	}
+
+	return writer.JSON(w, http.StatusOK, response.data)
+}
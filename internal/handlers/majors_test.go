@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"imi/college/internal/dictionaries"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/query"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const validMajorBody = `{
+	"name": "Programming",
+	"prefix": "P",
+	"nameOfficial": "Information systems and programming",
+	"code": "09.02.07",
+	"eduLevelId": 1,
+	"studyForm": "part-time",
+	"durationMonths": 46,
+	"qualification": "Programmer",
+	"tuitionCost": 120000,
+	"entranceTests": [{"name": "Maths", "minScore": 40}, {"name": "Interview"}]
+}`
+
+func decodeMajorBody(raw string) (CollegeMajorBody, error) {
+	r := httptest.NewRequest("POST", "/dictionaries/majors", strings.NewReader(raw))
+	r.Header.Set("Content-Type", "application/json")
+
+	return decodeDictionaryBody[CollegeMajorBody](r)
+}
+
+func TestCollegeMajorBodyValidation(t *testing.T) {
+	if _, err := decodeMajorBody(validMajorBody); err != nil {
+		t.Fatalf("valid body must be accepted, got %v", err)
+	}
+
+	invalid := map[string][2]string{
+		"unknown study form":       {`"studyForm": "part-time"`, `"studyForm": "evening"`},
+		"missing study form":       {`"studyForm": "part-time",`, ``},
+		"zero duration":            {`"durationMonths": 46`, `"durationMonths": 0`},
+		"negative duration":        {`"durationMonths": 46`, `"durationMonths": -12`},
+		"zero tuition cost":        {`"tuitionCost": 120000`, `"tuitionCost": 0`},
+		"unnamed entrance test":    {`{"name": "Interview"}`, `{"minScore": 10}`},
+		"negative entrance score":  {`"minScore": 40`, `"minScore": -1`},
+		"missing education level":  {`"eduLevelId": 1,`, ``},
+		"missing qualification":    {`"qualification": "Programmer",`, ``},
+		"entrance tests as object": {`[{"name": "Maths", "minScore": 40}, {"name": "Interview"}]`, `{"name": "Maths"}`},
+	}
+
+	for name, replacement := range invalid {
+		raw := strings.Replace(validMajorBody, replacement[0], replacement[1], 1)
+
+		_, err := decodeMajorBody(raw)
+		if _, ok := err.(httpx.APIError); !ok {
+			t.Errorf("%s: body must be rejected with APIError, got %v", name, err)
+		}
+	}
+
+	// paid places are optional
+	if _, err := decodeMajorBody(strings.Replace(validMajorBody, `"tuitionCost": 120000,`, ``, 1)); err != nil {
+		t.Errorf("body without tuition cost must be accepted, got %v", err)
+	}
+}
+
+func TestCollegeMajorApply(t *testing.T) {
+	admin := dictionaryAdmins[dictionaries.Majors].(dictionary[models.CollegeMajor, CollegeMajorBody])
+
+	body, err := decodeMajorBody(validMajorBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var major models.CollegeMajor
+	admin.apply(&major, nil, body)
+
+	if major.StudyForm != models.StudyFormPartTime {
+		t.Errorf("unexpected study form: %s", major.StudyForm)
+	}
+
+	if major.DurationMonths == nil || *major.DurationMonths != 46 {
+		t.Errorf("unexpected duration: %v", major.DurationMonths)
+	}
+
+	if major.TuitionCost == nil || *major.TuitionCost != 120000 {
+		t.Errorf("unexpected tuition cost: %v", major.TuitionCost)
+	}
+
+	if major.EduLevelID == nil || *major.EduLevelID != 1 {
+		t.Errorf("unexpected education level: %v", major.EduLevelID)
+	}
+
+	if len(major.EntranceTests) != 2 {
+		t.Fatalf("unexpected amount of entrance tests: %d", len(major.EntranceTests))
+	}
+
+	// tests keep the order they were sent in
+	for i, test := range major.EntranceTests {
+		if test.Position != i || test.Name != body.EntranceTests[i].Name {
+			t.Errorf("entrance test %d is out of order: %+v", i, test)
+		}
+	}
+
+	if major.EntranceTests[0].MinScore == nil || *major.EntranceTests[0].MinScore != 40 || major.EntranceTests[1].MinScore != nil {
+		t.Error("minimal scores must be kept as sent")
+	}
+}
+
+func TestMajorsCatalogueFilters(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		params url.Values
+		want   []string
+	}{
+		{url.Values{"studyForm": {"distance"}}, []string{"study_form = 'distance'"}},
+		{url.Values{"maxTuitionCost": {"90000"}}, []string{"tuition_cost <= 90000"}},
+		{url.Values{"paid": {"true"}, "budget": {"false"}}, []string{"(tuition_cost IS NOT NULL) = true", "budget = false"}},
+		{url.Values{"eduLevelId": {"2"}, "studyForm": {"full-time"}}, []string{"edu_level_id = 2", "study_form = 'full-time'"}},
+	}
+
+	for _, c := range cases {
+		list, err := query.ParseList(c.params, majorsCatalogueListSpec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var majors []models.CollegeMajor
+
+		stmt := db.Scopes(list.Scope).Find(&majors).Statement
+		sql := db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+
+		for _, want := range c.want {
+			if !strings.Contains(sql, want) {
+				t.Errorf("unexpected statement for %v:\nactual: %s\nexpected to contain: %s\n", c.params, sql, want)
+			}
+		}
+	}
+
+	invalid := []url.Values{
+		{"studyForm": {"evening"}},
+		{"maxTuitionCost": {"cheap"}},
+		{"paid": {"sometimes"}},
+		{"eduLevelId": {"first"}},
+	}
+
+	for _, params := range invalid {
+		if _, err := query.ParseList(params, majorsCatalogueListSpec); err == nil {
+			t.Errorf("%v must be rejected", params)
+		}
+	}
+}
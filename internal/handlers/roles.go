@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"imi/college/internal/checks"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/query"
+	"imi/college/internal/roles"
+	"imi/college/internal/sessions"
+	"imi/college/internal/validation"
+	"imi/college/internal/writer"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RolesHandler struct {
+	db     *gorm.DB
+	signer *sessions.Signer
+}
+
+// signed tokens carry permissions, so the ones issued to the users
+// before their permissions changed can't be used anymore
+func revokeSignedTokens(tx *gorm.DB, signer *sessions.Signer, userIDs ...uuid.UUID) error {
+	if signer == nil {
+		return nil
+	}
+
+	return signer.RevokeUsers(tx, userIDs)
+}
+
+func revokeRoleHolderTokens(tx *gorm.DB, signer *sessions.Signer, role models.Role) error {
+	if signer == nil {
+		return nil
+	}
+
+	ids, err := query.GetRoleUserIDs(tx, role.ID)
+	if err != nil {
+		return err
+	}
+
+	return revokeSignedTokens(tx, signer, ids...)
+}
+
+// GET /roles
+func (h *RolesHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	var data []models.Role
+
+	if err := h.db.Order("created_at").Find(&data).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, data)
+}
+
+type RoleBody struct {
+	Name        string                      `json:"name" validate:"required,gte=2,lte=64"`
+	DisplayName string                      `json:"displayName" validate:"required"`
+	Permissions permissions.PermissionTable `json:"permissions"`
+}
+
+func decodeRoleBody(r *http.Request) (RoleBody, error) {
+	var body RoleBody
+
+	if !checks.IsJson(r) {
+		return body, httpx.MalformedJSON()
+	}
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return body, httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return body, httpx.InvalidRequest(cause)
+		}
+		return body, err
+	}
+
+	return body, nil
+}
+
+// POST /roles
+func (h *RolesHandler) Create(w http.ResponseWriter, r *http.Request) error {
+	body, err := decodeRoleBody(r)
+	if err != nil {
+		return err
+	}
+
+	role := models.Role{
+		Name:        body.Name,
+		DisplayName: body.DisplayName,
+		Permissions: body.Permissions.Bits(),
+	}
+
+	if err := h.db.Create(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return httpx.BadRequest("role with this name already exists")
+		}
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, role)
+}
+
+func getRoleFromPath(db *gorm.DB, r *http.Request, param string) (models.Role, error) {
+	id, err := uuid.Parse(chi.URLParam(r, param))
+	if err != nil {
+		return models.Role{}, httpx.NotFound()
+	}
+
+	var role models.Role
+
+	if err := db.Where(&models.Role{ID: id}).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.Role{}, httpx.NotFound()
+		}
+		return models.Role{}, err
+	}
+
+	return role, nil
+}
+
+// PUT /roles/{roleId}
+func (h *RolesHandler) Update(w http.ResponseWriter, r *http.Request) error {
+	role, err := getRoleFromPath(h.db, r, "roleId")
+	if err != nil {
+		return err
+	}
+
+	body, err := decodeRoleBody(r)
+	if err != nil {
+		return err
+	}
+
+	// built-in roles are looked up by their names
+	if role.IsSystem && body.Name != role.Name {
+		return httpx.BadRequest("built-in roles cannot be renamed")
+	}
+
+	permissionsChanged := role.Permissions != body.Permissions.Bits()
+
+	txFn := func(tx *gorm.DB) error {
+		if err := query.SaveRolePermissions(tx, role, body.Permissions.Bits()); err != nil {
+			return err
+		}
+
+		role.Name = body.Name
+		role.DisplayName = body.DisplayName
+		role.Permissions = body.Permissions.Bits()
+
+		if err := tx.Model(&role).Select("name", "display_name").Updates(&role).Error; err != nil {
+			return err
+		}
+
+		if !permissionsChanged {
+			return nil
+		}
+
+		return revokeRoleHolderTokens(tx, h.signer, role)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			return httpx.BadRequest("role with this name already exists")
+		case errors.Is(err, query.ErrLastAdmin):
+			return httpx.BadRequest("the last admin cannot lose admin permission")
+		}
+		return err
+	}
+
+	// permissions of every user holding the role change
+	query.InvalidateUsers()
+
+	return writer.JSON(w, http.StatusOK, role)
+}
+
+// DELETE /roles/{roleId}
+func (h *RolesHandler) Delete(w http.ResponseWriter, r *http.Request) error {
+	role, err := getRoleFromPath(h.db, r, "roleId")
+	if err != nil {
+		return err
+	}
+
+	if role.IsSystem {
+		return httpx.BadRequest("built-in roles cannot be deleted")
+	}
+
+	// holders of the role lose its permissions the same way they would
+	// lose them if the permissions were cleared
+	txFn := func(tx *gorm.DB) error {
+		if err := query.SaveRolePermissions(tx, role, 0); err != nil {
+			return err
+		}
+
+		// holders are gone along with the role
+		if err := revokeRoleHolderTokens(tx, h.signer, role); err != nil {
+			return err
+		}
+
+		return tx.Delete(&role).Error
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		if errors.Is(err, query.ErrLastAdmin) {
+			return httpx.BadRequest("the last admin cannot lose admin permission")
+		}
+		return err
+	}
+
+	query.InvalidateUsers()
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
+
+type UserRolesBody struct {
+	Roles []string `json:"roles" validate:"required"`
+}
+
+// PUT /users/{userId}/roles
+//
+// replaces all roles of the user with the provided ones
+func (h *RolesHandler) Assign(w http.ResponseWriter, r *http.Request) error {
+	if !checks.IsJson(r) {
+		return httpx.MalformedJSON()
+	}
+
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionAdmin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var body UserRolesBody
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return httpx.InvalidRequest(cause)
+		}
+		return err
+	}
+
+	slices.Sort(body.Roles)
+	body.Roles = slices.Compact(body.Roles)
+
+	txFn := func(tx *gorm.DB) error {
+		found, err := roles.GetByNames(tx, body.Roles)
+		if err != nil {
+			return err
+		}
+
+		if len(found) != len(body.Roles) {
+			return httpx.BadRequest("some of the roles do not exist")
+		}
+
+		updated := targetUser
+		updated.Roles = found
+
+		if err := query.EnsureAdminRemains(tx, targetUser, updated.EffectivePermissions()); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&targetUser).Association("Roles").Replace(found); err != nil {
+			return err
+		}
+
+		return revokeSignedTokens(tx, h.signer, targetUser.ID)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		if errors.Is(err, query.ErrLastAdmin) {
+			return httpx.BadRequest("the last admin cannot lose admin permission")
+		}
+		return err
+	}
+
+	query.InvalidateUser(targetUser.ID)
+
+	return writer.JSON(w, http.StatusOK, map[string]any{
+		"roles":       targetUser.Roles,
+		"permissions": permissions.NewPermissionTable(targetUser.EffectivePermissions()),
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"imi/college/internal/checks"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/query"
+	"imi/college/internal/writer"
+	"net/http"
+	"slices"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ScopesHandler struct {
+	db *gorm.DB
+}
+
+// GET /users/{userId}/scopes
+//
+// majors the staff member is limited to, empty list means no limitations
+func (h *ScopesHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionAdmin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	majors, err := query.GetStaffScopeMajorIDs(h.db, targetUser.ID)
+	if err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"majorIds": majors})
+}
+
+type StaffScopesBody struct {
+	MajorIDs []uuid.UUID `json:"majorIds"`
+}
+
+// PUT /users/{userId}/scopes
+//
+// replaces majors the staff member is limited to
+func (h *ScopesHandler) Put(w http.ResponseWriter, r *http.Request) error {
+	if !checks.IsJson(r) {
+		return httpx.MalformedJSON()
+	}
+
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionAdmin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var body StaffScopesBody
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return httpx.MalformedJSON()
+	}
+
+	slices.SortFunc(body.MajorIDs, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+	body.MajorIDs = slices.Compact(body.MajorIDs)
+
+	txFn := func(tx *gorm.DB) error {
+		var found int64
+
+		if err := tx.Model(&models.CollegeMajor{}).Where("id IN ?", body.MajorIDs).Count(&found).Error; err != nil {
+			return err
+		}
+
+		if int(found) != len(body.MajorIDs) {
+			return httpx.BadRequest("some of the majors do not exist")
+		}
+
+		if err := tx.Where(&models.StaffScope{UserID: targetUser.ID}).Delete(&models.StaffScope{}).Error; err != nil {
+			return err
+		}
+
+		if len(body.MajorIDs) == 0 {
+			return nil
+		}
+
+		scopes := make([]models.StaffScope, 0, len(body.MajorIDs))
+		for _, majorID := range body.MajorIDs {
+			scopes = append(scopes, models.StaffScope{UserID: targetUser.ID, MajorID: majorID})
+		}
+
+		return tx.Create(&scopes).Error
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"majorIds": body.MajorIDs})
+}
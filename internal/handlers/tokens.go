@@ -4,27 +4,296 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"imi/college/internal/attempts"
 	"imi/college/internal/checks"
 	"imi/college/internal/env"
 	"imi/college/internal/httpx"
+	"imi/college/internal/jwt"
 	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/query"
 	"imi/college/internal/security"
+	"imi/college/internal/sessions"
+	"imi/college/internal/validation"
 	"imi/college/internal/writer"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TokensHandler struct {
 	db *gorm.DB
+	// nil unless the server issues signed tokens
+	signer *sessions.Signer
+	// failed sign in attempts per login
+	byUser *attempts.Tracker
+	// failed sign in attempts per client address
+	byIP *attempts.Tracker
+}
+
+// hash which is compared against when the user doesn't exist, so the
+// response takes the same time whether the username is registered or not
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// checks provided credentials, both unknown login and wrong password
+// result in the same APIError
+func (h *TokensHandler) authenticate(login string, password string) (models.User, error) {
+	hash := dummyHash
+	found := true
+
+	user, err := query.GetUserByLogin(h.db, login)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.User{}, err
+		}
+		found = false
+	}
+
+	if found {
+		var stored models.Password
+
+		if err := h.db.Where(&models.Password{UserID: user.ID}).First(&stored).Error; err != nil {
+			return models.User{}, err
+		}
+
+		hash = []byte(stored.Hash)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return models.User{}, httpx.InvalidCredentials(err)
+		}
+		return models.User{}, err
+	}
+
+	if !found {
+		return models.User{}, httpx.InvalidCredentials(gorm.ErrRecordNotFound)
+	}
+
+	return user, nil
+}
+
+// checks the second factor code of a user with 2FA enabled
+func (h *TokensHandler) verifySecondFactor(userID uuid.UUID, code string) error {
+	var ok bool
+
+	txFn := func(tx *gorm.DB) error {
+		var err error
+		ok, err = checkSecondFactor(tx, userID, code)
+		return err
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	if !ok {
+		return httpx.InvalidTwoFactorCode()
+	}
+
+	return nil
+}
+
+// refuses the attempt if either the login or the client's address has
+// to wait after previous failed attempts, otherwise the attempt is counted
+// as failed until it's given back by forgiveAttempt or succeedAttempt
+func (h *TokensHandler) beginAttempt(w http.ResponseWriter, login string, ip string) error {
+	wait, locked, err := h.byUser.Attempt(login)
+	if err != nil {
+		return err
+	}
+
+	if wait <= 0 {
+		wait, locked, err = h.byIP.Attempt(ip)
+		if err != nil {
+			h.forgive(h.byUser, login)
+			return err
+		}
+
+		// the attempt refused for the address didn't happen for the login
+		if wait > 0 {
+			h.forgive(h.byUser, login)
+		}
+	}
+
+	if wait <= 0 {
+		return nil
+	}
+
+	return refuseAttempt(w, wait, locked)
+}
+
+// tells the client when the refused attempt can be retried
+func refuseAttempt(w http.ResponseWriter, wait time.Duration, locked bool) error {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+	if locked {
+		return httpx.TemporarilyLocked(wait)
+	}
+
+	return httpx.TooManyAttempts(wait)
+}
+
+func (h *TokensHandler) forgive(tracker *attempts.Tracker, key string) {
+	if err := tracker.Forgive(key); err != nil {
+		slog.Error("Couldn't give back sign in attempt", "err", err.Error())
+	}
+}
+
+// gives back an attempt which neither failed nor succeeded
+func (h *TokensHandler) forgiveAttempt(login string, ip string) {
+	h.forgive(h.byUser, login)
+	h.forgive(h.byIP, ip)
+}
+
+// failures of the login are forgotten, while the address only gets the
+// attempt back, so signing into an account of their own doesn't let
+// the client keep guessing passwords of others
+func (h *TokensHandler) succeedAttempt(login string, ip string) {
+	if err := h.byUser.Reset(login); err != nil {
+		slog.Error("Couldn't reset sign in attempts", "err", err.Error())
+	}
+
+	h.forgive(h.byIP, ip)
 }
 
 type NewSessionBody struct {
-	UserName string `json:"username" validate:"required"`
+	// either username or email of the user
+	Identifier string `json:"identifier" validate:"required_without=UserName"`
+	// kept for clients which still sign in with username only
+	UserName string `json:"username" validate:"required_without=Identifier"`
 	Password string `json:"password" validate:"required,gte=6,lte=72"`
+	// second factor code, either TOTP or a recovery code
+	Code string `json:"code"`
+}
+
+// returns the provided identifier with emails normalised,
+// usernames are case sensitive and are returned as is
+func (b NewSessionBody) Login() string {
+	login := b.Identifier
+	if len(login) == 0 {
+		login = b.UserName
+	}
+
+	if strings.Contains(login, "@") {
+		return validation.NormalizeEmail(login)
+	}
+
+	return login
+}
+
+type SessionResponse struct {
+	models.UserToken
+	RefreshToken *models.RefreshToken `json:"refreshToken,omitempty"`
+}
+
+// creates a new access token for the user and, if requested, a refresh
+// token paired with it; refresh tokens created by rotation must be
+// given the family of the rotated token
+func (h *TokensHandler) issueSession(tx *gorm.DB, user models.User, withRefresh bool, familyID uuid.UUID) (SessionResponse, error) {
+	if withRefresh && familyID == uuid.Nil {
+		familyID = uuid.New()
+	}
+
+	var userToken models.UserToken
+	var accessTokenID *uuid.UUID
+
+	// signed tokens are not stored, so refresh tokens
+	// are tied to them only through the family
+	if h.signer != nil {
+		var err error
+
+		userToken, err = h.signer.Issue(user, familyID)
+		if err != nil {
+			return SessionResponse{}, err
+		}
+	} else {
+		newToken, err := security.NewToken(security.DEFAULT_TOKEN_SIZE)
+		if err != nil {
+			return SessionResponse{}, err
+		}
+
+		now := time.Now()
+
+		userToken = models.UserToken{
+			UserID:     user.ID,
+			Token:      newToken,
+			CreatedAt:  now,
+			LastUsedAt: now,
+			ExpiresAt:  now.Add(env.SessionTTL()),
+		}
+
+		if err := tx.Create(&userToken).Error; err != nil {
+			return SessionResponse{}, err
+		}
+
+		accessTokenID = &userToken.ID
+	}
+
+	session := SessionResponse{UserToken: userToken}
+
+	if !withRefresh {
+		return session, nil
+	}
+
+	newRefreshToken, err := security.NewToken(security.DEFAULT_TOKEN_SIZE)
+	if err != nil {
+		return SessionResponse{}, err
+	}
+
+	now := time.Now()
+
+	refreshToken := models.RefreshToken{
+		UserID:        user.ID,
+		FamilyID:      familyID,
+		AccessTokenID: accessTokenID,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(env.RefreshTokenTTL()),
+		Token:         newRefreshToken,
+	}
+
+	if err := tx.Create(&refreshToken).Error; err != nil {
+		return SessionResponse{}, err
+	}
+
+	session.RefreshToken = &refreshToken
+
+	return session, nil
+}
+
+func setTokenCookie(w http.ResponseWriter, token models.UserToken) {
+	expiresAt := token.ExpiresAt
+
+	// with sliding expiration the token outlives its initial
+	// expiration time, so the cookie must live until the hard limit
+	if env.SessionSliding() {
+		expiresAt = token.CreatedAt.Add(env.SessionMaxAge())
+	}
+
+	cookie := http.Cookie{
+		Name:     "token",
+		Value:    fmt.Sprintf("Bearer %v", token.Token),
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		HttpOnly: true,
+		MaxAge:   int(time.Until(expiresAt).Seconds()),
+	}
+
+	// in production assume SSL
+	if env.IsProduction() {
+		cookie.Secure = true
+	}
+
+	http.SetCookie(w, &cookie)
 }
 
 // POST /tokens
@@ -46,7 +315,7 @@ func (h *TokensHandler) Create(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate := validation.NewValidator()
 	if err := validate.Struct(body); err != nil {
 		if cause, casted := err.(validator.ValidationErrors); casted {
 			return httpx.InvalidRequest(cause)
@@ -54,59 +323,187 @@ func (h *TokensHandler) Create(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	var user models.User
+	ip := httpx.ClientIP(r)
 
-	if err := h.db.Where(&models.User{UserName: body.UserName}).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return httpx.InvalidCredentials(err)
-		}
-		return err
-	}
-
-	var password models.Password
+	login := body.Login()
 
-	if err := h.db.Where(&models.Password{User: user}).First(&password).Error; err != nil {
+	if err := h.beginAttempt(w, login, ip); err != nil {
 		return err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(password.Hash), []byte(body.Password)); err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return httpx.InvalidCredentials(err)
+	user, err := h.authenticate(login, body.Password)
+	if err != nil {
+		if _, ok := err.(httpx.APIError); !ok {
+			h.forgiveAttempt(login, ip)
 		}
 		return err
 	}
 
-	newToken, err := security.NewToken(security.DEFAULT_TOKEN_SIZE)
+	hasTwoFactor, err := query.HasTwoFactor(h.db, user.ID)
 	if err != nil {
+		h.forgiveAttempt(login, ip)
 		return err
 	}
 
-	userToken := models.UserToken{User: user, Token: newToken}
+	if hasTwoFactor {
+		// missing code is not a failure, the client is expected
+		// to ask the user for it and repeat the request
+		if len(body.Code) == 0 {
+			h.forgiveAttempt(login, ip)
+			return httpx.TwoFactorRequired()
+		}
 
-	if err := h.db.Create(&userToken).Error; err != nil {
+		if err := h.verifySecondFactor(user.ID, body.Code); err != nil {
+			if _, ok := err.(httpx.APIError); !ok {
+				h.forgiveAttempt(login, ip)
+			}
+			return err
+		}
+	}
+
+	h.succeedAttempt(login, ip)
+
+	withRefresh := r.URL.Query().Get("refresh") == "true"
+
+	var session SessionResponse
+
+	txFn := func(tx *gorm.DB) error {
+		var err error
+		session, err = h.issueSession(tx, user, withRefresh, uuid.Nil)
+		return err
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
 		return err
 	}
 
 	// check if requested token needs to be attached to a cookie
 	if r.URL.Query().Get("cookie") == "true" {
-		cookie := http.Cookie{
-			Name:     "token",
-			Value:    fmt.Sprintf("Bearer %v", userToken.Token),
-			Path:     "/",
-			SameSite: http.SameSiteLaxMode,
-			HttpOnly: true,
-			MaxAge:   int(time.Until(userToken.ExpiresAt).Seconds()),
+		setTokenCookie(w, session.UserToken)
+	}
+
+	return writer.JSON(w, http.StatusOK, session)
+}
+
+type RefreshSessionBody struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// POST /tokens/refresh
+//
+// exchanges a refresh token for a new pair of access and refresh tokens,
+// presenting an already rotated refresh token revokes its whole family
+func (h *TokensHandler) Refresh(w http.ResponseWriter, r *http.Request) error {
+	if !checks.IsJson(r) {
+		return httpx.MalformedJSON()
+	}
+
+	var body RefreshSessionBody
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return httpx.InvalidRequest(cause)
+		}
+		return err
+	}
+
+	var session SessionResponse
+	var reused bool
+	var familyID uuid.UUID
+	var previous models.UserToken
+
+	txFn := func(tx *gorm.DB) error {
+		var current models.RefreshToken
+
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(&models.RefreshToken{Token: body.RefreshToken}).
+			First(&current).Error; err != nil {
+			return err
 		}
 
-		// in production assume SSL
-		if env.IsProduction() {
-			cookie.Secure = true
+		// the transaction has to be committed for revocation to persist,
+		// so the reuse is reported after the transaction is done
+		if current.UsedAt != nil || current.RevokedAt != nil {
+			reused = true
+			familyID = current.FamilyID
+			return query.RevokeRefreshFamily(tx, current.FamilyID)
 		}
 
-		http.SetCookie(w, &cookie)
+		if current.ExpiresAt.Before(time.Now()) {
+			return httpx.InvalidCredentials(fmt.Errorf("refresh token has expired"))
+		}
+
+		if err := tx.Model(&current).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		// previous access token is replaced by the new one, its value
+		// is returned so the token can be dropped from the cache
+		if current.AccessTokenID != nil {
+			err := tx.
+				Clauses(clause.Returning{Columns: []clause.Column{{Name: "token"}}}).
+				Where("id = ?", *current.AccessTokenID).
+				Delete(&previous).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		user, err := query.GetUserByID(tx, current.UserID)
+		if err != nil {
+			return err
+		}
+
+		session, err = h.issueSession(tx, user, true, current.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		return nil
 	}
 
-	return writer.JSON(w, http.StatusOK, userToken)
+	if err := h.db.Transaction(txFn); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.InvalidCredentials(err)
+		}
+		return err
+	}
+
+	if len(previous.Token) > 0 {
+		query.InvalidateToken(previous.Token)
+	}
+
+	if reused {
+		query.InvalidateTokens()
+
+		// signed access tokens of the family can't be deleted,
+		// so the family is revoked until they expire
+		if h.signer != nil {
+			if err := h.signer.Revoke(h.db, familyID.String(), time.Now().Add(h.signer.TTL())); err != nil {
+				return err
+			}
+		}
+		return httpx.InvalidCredentials(ErrRefreshTokenReused)
+	}
+
+	if r.URL.Query().Get("cookie") == "true" {
+		setTokenCookie(w, session.UserToken)
+	}
+
+	return writer.JSON(w, http.StatusOK, session)
 }
 
 // DELETE /tokens
@@ -121,6 +518,61 @@ func (h *TokensHandler) Delete(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	if h.signer != nil && jwt.IsJWT(inputToken) {
+		err = h.revokeSigned(inputToken)
+	} else {
+		err = h.deleteOpaque(inputToken)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if r.URL.Query().Get("cookie") == "unset" {
+		http.SetCookie(w, &http.Cookie{
+			Name:   "token",
+			MaxAge: -999,
+		})
+	}
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
+
+// signed tokens can't be deleted, instead their ids are put
+// on the revocation list until they expire
+func (h *TokensHandler) revokeSigned(inputToken string) error {
+	_, claims, err := h.signer.Verify(inputToken)
+	if err != nil {
+		return httpx.BadRequest("invalid token")
+	}
+
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+
+	if err := h.signer.Revoke(h.db, claims.ID, expiresAt); err != nil {
+		return err
+	}
+
+	if len(claims.Family) == 0 {
+		return nil
+	}
+
+	familyID, err := uuid.Parse(claims.Family)
+	if err != nil {
+		return err
+	}
+
+	if err := query.RevokeRefreshFamily(h.db, familyID); err != nil {
+		return err
+	}
+
+	query.InvalidateTokens()
+
+	return nil
+}
+
+func (h *TokensHandler) deleteOpaque(inputToken string) error {
+	var revoked bool
+
 	txFn := func(tx *gorm.DB) error {
 		var userToken models.UserToken
 
@@ -128,6 +580,20 @@ func (h *TokensHandler) Delete(w http.ResponseWriter, r *http.Request) error {
 			return err
 		}
 
+		// logging out also ends the refresh token family of the session
+		var refreshToken models.RefreshToken
+
+		if err := tx.Where(&models.RefreshToken{AccessTokenID: &userToken.ID}).Limit(1).Find(&refreshToken).Error; err != nil {
+			return err
+		}
+
+		if refreshToken.ID != uuid.Nil {
+			if err := query.RevokeRefreshFamily(tx, refreshToken.FamilyID); err != nil {
+				return err
+			}
+			revoked = true
+		}
+
 		if err := tx.Delete(userToken).Error; err != nil {
 			return err
 		}
@@ -142,12 +608,68 @@ func (h *TokensHandler) Delete(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	if r.URL.Query().Get("cookie") == "unset" {
-		http.SetCookie(w, &http.Cookie{
-			Name:   "token",
-			MaxAge: -999,
-		})
+	query.InvalidateToken(inputToken)
+
+	// values of the family's access tokens aren't known here
+	if revoked {
+		query.InvalidateTokens()
 	}
 
-	return writer.JSON(w, http.StatusOK, map[string]any{"deleted": true})
+	return nil
+}
+
+// POST /users/{userId}/impersonate
+//
+// issues a short-lived token letting an admin see the service the way
+// the applicant sees it; every request made with the token is audited
+// and destructive actions are refused
+func (h *TokensHandler) Impersonate(w http.ResponseWriter, r *http.Request) error {
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionAdmin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	if targetUser.ID == currentUser.ID {
+		return httpx.BadRequest("users can't impersonate themselves")
+	}
+
+	// staff accounts are never impersonated, so impersonation
+	// can't be used to borrow someone else's permissions
+	if permissions.IsElevated(targetUser.EffectivePermissions()) {
+		return httpx.Forbidden()
+	}
+
+	var userToken models.UserToken
+
+	if h.signer != nil {
+		userToken, err = h.signer.IssueImpersonation(targetUser, currentUser.ID, env.ImpersonationTTL())
+		if err != nil {
+			return err
+		}
+	} else {
+		newToken, err := security.NewToken(security.DEFAULT_TOKEN_SIZE)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		userToken = models.UserToken{
+			UserID:         targetUser.ID,
+			ImpersonatorID: &currentUser.ID,
+			Token:          newToken,
+			CreatedAt:      now,
+			LastUsedAt:     now,
+			ExpiresAt:      now.Add(env.ImpersonationTTL()),
+		}
+
+		if err := h.db.Create(&userToken).Error; err != nil {
+			return err
+		}
+	}
+
+	return writer.JSON(w, http.StatusOK, userToken)
 }
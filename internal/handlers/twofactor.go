@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"imi/college/internal/attempts"
+	"imi/college/internal/checks"
+	"imi/college/internal/ctx"
+	"imi/college/internal/env"
+	"imi/college/internal/httpx"
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/totp"
+	"imi/college/internal/validation"
+	"imi/college/internal/writer"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// amount of time steps around the current one which are accepted
+const totpSkew = 1
+
+const recoveryCodesAmount = 10
+
+type TwoFactorHandler struct {
+	db *gorm.DB
+	// failed attempts per username, shared with signing in
+	byUser *attempts.Tracker
+}
+
+// checks the code against user's authenticator and, if it doesn't match,
+// against unused recovery codes; a matched recovery code gets spent
+// and a time step can't be used twice
+func checkSecondFactor(tx *gorm.DB, userID uuid.UUID, code string) (bool, error) {
+	var userTotp models.UserTOTP
+
+	if err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(&models.UserTOTP{UserID: userID}).
+		Where("confirmed_at IS NOT NULL").
+		First(&userTotp).Error; err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.Validate(userTotp.Secret, code, time.Now(), totpSkew); ok {
+		if step <= userTotp.LastUsedStep {
+			return false, nil
+		}
+		return true, tx.Model(&userTotp).Update("last_used_step", step).Error
+	}
+
+	result := tx.
+		Model(&models.RecoveryCode{}).
+		Where(&models.RecoveryCode{UserID: userID, Hash: totp.HashRecoveryCode(code)}).
+		Where("used_at IS NULL").
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// replaces all recovery codes of the user with new ones, plain codes
+// are returned to be shown to the user once and only hashes are stored
+func newRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where(&models.RecoveryCode{UserID: userID}).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodesAmount)
+	entries := make([]models.RecoveryCode, 0, recoveryCodesAmount)
+
+	for range recoveryCodesAmount {
+		code, err := totp.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+		entries = append(entries, models.RecoveryCode{UserID: userID, Hash: totp.HashRecoveryCode(code)})
+	}
+
+	if err := tx.Create(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// 2FA enrollment is only allowed to the owner of the account
+func getOwnerFromPath(db *gorm.DB, r *http.Request, param string) (models.User, error) {
+	currentUser, err := ctx.GetCurrentUser(r)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	targetUser, err := httpx.GetTargetUserFromPathValue(db, r, param)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if targetUser.ID != currentUser.ID {
+		return models.User{}, httpx.Forbidden()
+	}
+
+	return targetUser, nil
+}
+
+// GET /users/{userId}/totp
+func (h *TwoFactorHandler) Read(w http.ResponseWriter, r *http.Request) error {
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var userTotp models.UserTOTP
+
+	if err := h.db.Where(&models.UserTOTP{UserID: targetUser.ID}).Limit(1).Find(&userTotp).Error; err != nil {
+		return err
+	}
+
+	var codesLeft int64
+
+	if err := h.db.
+		Model(&models.RecoveryCode{}).
+		Where(&models.RecoveryCode{UserID: targetUser.ID}).
+		Where("used_at IS NULL").
+		Count(&codesLeft).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, map[string]any{
+		"enabled":           userTotp.ConfirmedAt != nil,
+		"confirmedAt":       userTotp.ConfirmedAt,
+		"recoveryCodesLeft": codesLeft,
+	})
+}
+
+// POST /users/{userId}/totp
+//
+// starts 2FA enrollment, the returned secret is not used
+// for signing in until it is confirmed with a code
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) error {
+	user, err := getOwnerFromPath(h.db, r, "userId")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var existing models.UserTOTP
+
+	if err := h.db.Where(&models.UserTOTP{UserID: user.ID}).Limit(1).Find(&existing).Error; err != nil {
+		return err
+	}
+
+	if existing.ConfirmedAt != nil {
+		return httpx.BadRequest("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return err
+	}
+
+	// restarting enrollment replaces the previous unconfirmed secret
+	userTotp := models.UserTOTP{UserID: user.ID, CreatedAt: time.Now(), Secret: secret}
+
+	if err := h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"created_at", "secret", "confirmed_at", "last_used_step"}),
+	}).Create(&userTotp).Error; err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, map[string]any{
+		"secret": secret,
+		"uri":    totp.ProvisioningURI(env.TwoFactorIssuer(), user.UserName, secret),
+	})
+}
+
+type TwoFactorCodeBody struct {
+	Code string `json:"code" validate:"required"`
+}
+
+func decodeTwoFactorCode(r *http.Request) (TwoFactorCodeBody, error) {
+	var body TwoFactorCodeBody
+
+	if !checks.IsJson(r) {
+		return body, httpx.MalformedJSON()
+	}
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return body, httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return body, httpx.InvalidRequest(cause)
+		}
+		return body, err
+	}
+
+	return body, nil
+}
+
+// POST /users/{userId}/totp/confirm
+//
+// finishes 2FA enrollment and responds with recovery codes,
+// which are never shown again
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) error {
+	user, err := getOwnerFromPath(h.db, r, "userId")
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	body, err := decodeTwoFactorCode(r)
+	if err != nil {
+		return err
+	}
+
+	var codes []string
+
+	txFn := func(tx *gorm.DB) error {
+		var userTotp models.UserTOTP
+
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(&models.UserTOTP{UserID: user.ID}).
+			Where("confirmed_at IS NULL").
+			First(&userTotp).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return httpx.BadRequest("two-factor authentication enrollment wasn't started")
+			}
+			return err
+		}
+
+		step, ok := totp.Validate(userTotp.Secret, body.Code, time.Now(), totpSkew)
+		if !ok {
+			return httpx.InvalidTwoFactorCode()
+		}
+
+		now := time.Now()
+
+		if err := tx.Model(&userTotp).Updates(models.UserTOTP{ConfirmedAt: &now, LastUsedStep: step}).Error; err != nil {
+			return err
+		}
+
+		codes, err = newRecoveryCodes(tx, user.ID)
+		return err
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"recoveryCodes": codes})
+}
+
+type DisableTwoFactorBody struct {
+	Password string `json:"password" validate:"required,gte=6,lte=72"`
+	Code     string `json:"code" validate:"required"`
+}
+
+func decodeDisableTwoFactor(r *http.Request) (DisableTwoFactorBody, error) {
+	var body DisableTwoFactorBody
+
+	if !checks.IsJson(r) {
+		return body, httpx.MalformedJSON()
+	}
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return body, httpx.MalformedJSON()
+	}
+
+	validate := validation.NewValidator()
+	if err := validate.Struct(body); err != nil {
+		if cause, ok := err.(validator.ValidationErrors); ok {
+			return body, httpx.InvalidRequest(cause)
+		}
+		return body, err
+	}
+
+	return body, nil
+}
+
+// checks the password of the user, so a stolen access
+// token alone isn't enough to weaken the account
+func checkPassword(db *gorm.DB, userID uuid.UUID, password string) error {
+	var stored models.Password
+
+	if err := db.Where(&models.Password{UserID: userID}).First(&stored).Error; err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(stored.Hash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return httpx.InvalidCredentials(err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// DELETE /users/{userId}/totp
+//
+// owners disable 2FA by providing their password and a code, failed
+// attempts are throttled the same way signing in is; admins can disable
+// it without either for users who have lost their authenticator
+func (h *TwoFactorHandler) Delete(w http.ResponseWriter, r *http.Request) error {
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionAdmin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	isOwner := currentUser.ID == targetUser.ID
+
+	var body DisableTwoFactorBody
+
+	if isOwner {
+		body, err = decodeDisableTwoFactor(r)
+		if err != nil {
+			return err
+		}
+
+		wait, locked, err := h.byUser.Attempt(targetUser.UserName)
+		if err != nil {
+			return err
+		}
+
+		if wait > 0 {
+			return refuseAttempt(w, wait, locked)
+		}
+	}
+
+	// the attempt stays counted only when the password or the code is wrong
+	failed := false
+
+	txFn := func(tx *gorm.DB) error {
+		if isOwner {
+			if err := checkPassword(tx, targetUser.ID, body.Password); err != nil {
+				_, failed = err.(httpx.APIError)
+				return err
+			}
+
+			ok, err := checkSecondFactor(tx, targetUser.ID, body.Code)
+			if err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return httpx.BadRequest("two-factor authentication is not enabled")
+				}
+				return err
+			}
+
+			if !ok {
+				failed = true
+				return httpx.InvalidTwoFactorCode()
+			}
+		}
+
+		if err := tx.Where(&models.RecoveryCode{UserID: targetUser.ID}).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where(&models.UserTOTP{UserID: targetUser.ID}).Delete(&models.UserTOTP{}).Error
+	}
+
+	err = h.db.Transaction(txFn)
+
+	if isOwner {
+		h.finishAttempt(targetUser.UserName, err == nil, failed)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
+
+// forgets failures after a success, gives back attempts which
+// neither succeeded nor failed and keeps failed ones counted
+func (h *TwoFactorHandler) finishAttempt(key string, succeeded bool, failed bool) {
+	var err error
+
+	switch {
+	case succeeded:
+		err = h.byUser.Reset(key)
+	case !failed:
+		err = h.byUser.Forgive(key)
+	}
+
+	if err != nil {
+		slog.Error("Couldn't update two-factor attempts", "err", err.Error())
+	}
+}
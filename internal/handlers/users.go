@@ -4,21 +4,31 @@ import (
 	"encoding/json"
 	"errors"
 	"imi/college/internal/checks"
+	"imi/college/internal/ctx"
+	"imi/college/internal/erasure"
+	"imi/college/internal/history"
 	"imi/college/internal/httpx"
 	"imi/college/internal/models"
 	"imi/college/internal/permissions"
+	"imi/college/internal/query"
+	"imi/college/internal/sessions"
 	"imi/college/internal/types/date"
 	"imi/college/internal/validation"
 	"imi/college/internal/writer"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type UserHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	signer *sessions.Signer
+	eraser *erasure.Eraser
 }
 
 type CreateUserBody struct {
@@ -32,6 +42,11 @@ type CreateUserBody struct {
 	Email      string    `json:"email" validate:"required,email"`
 	Tel        string    `json:"tel" validate:"required,e164"`
 	NeedsDorm  bool      `json:"needsDorm"`
+	// version of personal data processing terms the user has accepted,
+	// it must be the version in effect
+	ConsentVersionID int `json:"consentVersionId" validate:"required"`
+	// name of the parent consenting on behalf of a minor
+	ParentName *string `json:"parentName" validate:"omitnil,gte=2"`
 }
 
 func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) error {
@@ -39,7 +54,7 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) error {
 		return httpx.MalformedJSON()
 	}
 
-	if _, err := httpx.GetCurrentUserFromRequest(h.db, r); err == nil {
+	if _, err := httpx.GetCurrentUserFromRequest(h.db, h.signer, r); err == nil {
 		return httpx.BadRequest("authenticated users cannot create new accounts")
 	}
 
@@ -66,7 +81,7 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) error {
 
 	txFn := func(tx *gorm.DB) error {
 		user = models.User{
-			Email:    body.Email,
+			Email:    validation.NormalizeEmail(body.Email),
 			UserName: body.UserName,
 		}
 
@@ -74,6 +89,16 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) error {
 			return err
 		}
 
+		var applicant models.Role
+
+		if err := tx.Where(&models.Role{Name: permissions.RoleApplicant}).First(&applicant).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Association("Roles").Append(&applicant); err != nil {
+			return err
+		}
+
 		details := models.UserDetails{
 			UserID:     user.ID,
 			FirstName:  body.FirstName,
@@ -89,6 +114,12 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) error {
 			return err
 		}
 
+		user.Details = &details
+
+		if _, err := acceptConsent(tx, r, user, body.ConsentVersionID, body.ParentName); err != nil {
+			return err
+		}
+
 		hashedPassword, hashErr := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
 		if hashErr != nil {
 			return hashErr
@@ -145,7 +176,7 @@ func (h *UserHandler) PutDetails(w http.ResponseWriter, r *http.Request) error {
 		return httpx.BadRequest("request must contain JSON body")
 	}
 
-	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionEditUser)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return httpx.NotFound()
@@ -192,9 +223,262 @@ func (h *UserHandler) PutDetails(w http.ResponseWriter, r *http.Request) error {
 		details.ID = targetUser.Details.ID
 	}
 
-	if err := h.db.Debug().Save(&details).Error; err != nil {
+	actorID := httpx.GetActorID(r, currentUser)
+
+	txFn := func(tx *gorm.DB) error {
+		if err := tx.Save(&details).Error; err != nil {
+			return err
+		}
+
+		change := history.Change{
+			ActorID:  &actorID,
+			OwnerID:  targetUser.ID,
+			Entity:   history.EntityDetails,
+			EntityID: details.ID,
+			After:    details,
+		}
+
+		if targetUser.Details != nil {
+			change.Before = *targetUser.Details
+		}
+
+		return history.Record(tx, change)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
 		return err
 	}
 
+	query.InvalidateUser(targetUser.ID)
+
 	return writer.JSON(w, http.StatusOK, map[string]any{"success": true})
 }
+
+// GET /users/{userId}/permissions
+//
+// effective permissions of the user, so the frontend
+// can hide controls the user isn't allowed to use
+func (h *UserHandler) ReadPermissions(w http.ResponseWriter, r *http.Request) error {
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionViewUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, permissions.NewPermissionTable(targetUser.EffectivePermissions()))
+}
+
+// PUT /users/{userId}/permissions
+//
+// replaces permissions granted to the user directly,
+// permissions coming from roles are left as is
+func (h *UserHandler) PutPermissions(w http.ResponseWriter, r *http.Request) error {
+	if !checks.IsJson(r) {
+		return httpx.MalformedJSON()
+	}
+
+	_, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionAdmin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var body permissions.PermissionTable
+
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		return httpx.MalformedJSON()
+	}
+
+	updated := targetUser
+	updated.Permissions = body.Bits()
+
+	txFn := func(tx *gorm.DB) error {
+		if err := query.EnsureAdminRemains(tx, targetUser, updated.EffectivePermissions()); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&targetUser).UpdateColumn("permissions", updated.Permissions).Error; err != nil {
+			return err
+		}
+
+		return revokeSignedTokens(tx, h.signer, targetUser.ID)
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		if errors.Is(err, query.ErrLastAdmin) {
+			return httpx.BadRequest("the last admin cannot lose admin permission")
+		}
+		return err
+	}
+
+	query.InvalidateUser(targetUser.ID)
+
+	return writer.JSON(w, http.StatusOK, permissions.NewPermissionTable(updated.EffectivePermissions()))
+}
+
+// DELETE /users/{userId}
+//
+// erases the account along with the user's personal data, admins can
+// erase users referenced by enrollment orders with ?override=legal-hold
+func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) error {
+	currentUser, targetUser, err := httpx.GetUsersFromPathWithUAC(h.db, r, "userId", permissions.PermissionDeleteUser)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	var opts erasure.Options
+
+	if r.URL.Query().Get("override") == "legal-hold" {
+		if !permissions.HasAdmin(currentUser.EffectivePermissions()) {
+			return httpx.Forbidden()
+		}
+		opts.LegalHoldOverride = true
+	}
+
+	if err := h.eraser.Erase(targetUser.ID, opts); err != nil {
+		switch {
+		case errors.Is(err, erasure.ErrEnrolled):
+			return httpx.UserEnrolled()
+		case errors.Is(err, query.ErrLastAdmin):
+			return httpx.BadRequest("the last admin cannot be deleted")
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return httpx.NotFound()
+		}
+		return err
+	}
+
+	return writer.JSON(w, http.StatusOK, map[string]any{"deleted": true})
+}
+
+var usersListSpec = query.ListSpec{
+	Sort: map[string]query.SortField{
+		"createdAt": {Column: "users.created_at", Field: "CreatedAt"},
+		"email":     {Column: "users.email", Field: "Email"},
+		// users who haven't filled in their details yet have no names
+		"firstName":  {Column: `"Details".first_name`, Field: "Details.FirstName", Nullable: true},
+		"middleName": {Column: `"Details".middle_name`, Field: "Details.MiddleName", Nullable: true},
+	},
+	DefaultSort: "createdAt",
+	Key:         query.SortField{Column: "users.id", Field: "ID"},
+	Filters: map[string]query.Filter{
+		"needsDorm": {Column: `"Details".needs_dorm`, Parse: query.ParseBool},
+		"verified":  {Column: "users.is_verified", Parse: query.ParseBool},
+	},
+	DefaultLimit: 50,
+	MaxLimit:     200,
+}
+
+func parseOptionalInt(params url.Values, name string) (*int, error) {
+	value := params.Get(name)
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, httpx.BadRequest(name + " must be a number")
+	}
+
+	return &parsed, nil
+}
+
+// search conditions of GET /users besides the list filters
+func parseUserSearch(params url.Values) (query.UserSearch, error) {
+	var err error
+
+	search := query.UserSearch{Query: params.Get("q")}
+
+	if value := params.Get("majorId"); len(value) > 0 {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return query.UserSearch{}, httpx.BadRequest("majorId must be a valid uuid")
+		}
+		search.MajorID = &id
+	}
+
+	if search.StatusID, err = parseOptionalInt(params, "statusId"); err != nil {
+		return query.UserSearch{}, err
+	}
+
+	if search.RegionID, err = parseOptionalInt(params, "regionId"); err != nil {
+		return query.UserSearch{}, err
+	}
+
+	return search, nil
+}
+
+// GET /users
+//
+// searches users by q over names, email, phone and SNILS; can be
+// filtered by majorId, statusId, needsDorm, regionId and verified and
+// sorted by createdAt, email, firstName or middleName, prefixed with
+// "-" for descending order; pages are requested with limit and the
+// cursor returned along with the previous page
+func (h *UserHandler) Search(w http.ResponseWriter, r *http.Request) error {
+	currentUser, err := ctx.GetCurrentUser(r)
+	if err != nil {
+		return err
+	}
+
+	list, err := httpx.ParseList(r, usersListSpec)
+	if err != nil {
+		return err
+	}
+
+	search, err := parseUserSearch(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	if !permissions.HasAdmin(currentUser.EffectivePermissions()) {
+		search.ScopeMajorIDs, err = query.GetStaffScopeMajorIDs(h.db, currentUser.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var users []models.User
+
+	if err := h.db.Model(&models.User{}).Joins("Details").Scopes(search.Scope, list.Scope).Find(&users).Error; err != nil {
+		return err
+	}
+
+	users, nextCursor, err := query.Paginate(list, users)
+	if err != nil {
+		return err
+	}
+
+	// the page discloses the same personal data reading each user would,
+	// so access to every listed user is audited, unaudited access is refused
+	txFn := func(tx *gorm.DB) error {
+		for _, user := range users {
+			if user.ID == currentUser.ID {
+				continue
+			}
+
+			if err := httpx.RecordAccess(tx, r, currentUser.ID, user.ID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := h.db.Transaction(txFn); err != nil {
+		return err
+	}
+
+	return writer.Paginated(w, http.StatusOK, users, nextCursor)
+}
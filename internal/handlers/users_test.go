@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"imi/college/internal/httpx"
+	"imi/college/internal/query"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseUserSearch(t *testing.T) {
+	majorID := uuid.New()
+
+	search, err := parseUserSearch(url.Values{
+		"q":        {"ivanov 8912"},
+		"majorId":  {majorID.String()},
+		"statusId": {"2"},
+		"regionId": {"54"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if search.Query != "ivanov 8912" {
+		t.Errorf("unexpected query: %q", search.Query)
+	}
+
+	if search.MajorID == nil || *search.MajorID != majorID {
+		t.Errorf("unexpected major: %v", search.MajorID)
+	}
+
+	if search.StatusID == nil || *search.StatusID != 2 || search.RegionID == nil || *search.RegionID != 54 {
+		t.Errorf("unexpected status or region: %v %v", search.StatusID, search.RegionID)
+	}
+
+	// missing parameters don't filter anything
+	search, err = parseUserSearch(url.Values{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if search.MajorID != nil || search.StatusID != nil || search.RegionID != nil {
+		t.Errorf("empty search must have no filters, got %+v", search)
+	}
+
+	invalid := []url.Values{
+		{"majorId": {"42"}},
+		{"statusId": {"accepted"}},
+		{"regionId": {"1.5"}},
+		{"q": {"ivanov"}, "regionId": {"novosibirsk"}},
+	}
+
+	for _, params := range invalid {
+		_, err := parseUserSearch(params)
+		if _, ok := err.(httpx.APIError); !ok {
+			t.Errorf("%v must be rejected with APIError, got %v", params, err)
+		}
+	}
+}
+
+func TestUsersListParams(t *testing.T) {
+	valid := []url.Values{
+		{"needsDorm": {"true"}, "verified": {"false"}},
+		{"sort": {"-firstName"}, "limit": {"200"}},
+		{"sort": {"middleName"}, "needsDorm": {"false"}},
+		{"sort": {"-email"}, "verified": {"true"}},
+	}
+
+	for _, params := range valid {
+		if _, err := query.ParseList(params, usersListSpec); err != nil {
+			t.Errorf("%v must be accepted, got %v", params, err)
+		}
+	}
+
+	invalid := []url.Values{
+		{"needsDorm": {"yes please"}},
+		{"verified": {"2"}},
+		{"sort": {"lastName"}},
+		{"sort": {"password"}},
+		{"limit": {"201"}},
+		{"limit": {"-1"}},
+		{"cursor": {"garbage"}},
+	}
+
+	for _, params := range invalid {
+		_, err := query.ParseList(params, usersListSpec)
+		if _, ok := err.(query.ListParamError); !ok {
+			t.Errorf("%v must be rejected with ListParamError, got %v", params, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"imi/college/internal/models"
+	"imi/college/internal/types/jsonb"
+	"reflect"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// kinds of entities whose history is kept
+const (
+	EntityDetails      = "details"
+	EntityAddress      = "address"
+	EntityIdentityDoc  = "identity"
+	EntityEducationDoc = "education"
+	EntityApplication  = "application"
+	EntityGuardian     = "guardian"
+)
+
+var Entities = []string{EntityDetails, EntityAddress, EntityIdentityDoc, EntityEducationDoc, EntityApplication, EntityGuardian}
+
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+var schemas sync.Map
+
+// values of the model's database columns keyed by column names and
+// encoded as JSON, so values of different origin compare reliably
+func columns(value any) (map[string]json.RawMessage, error) {
+	if value == nil {
+		return map[string]json.RawMessage{}, nil
+	}
+
+	s, err := schema.Parse(value, &schemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	result := make(map[string]json.RawMessage, len(s.DBNames))
+
+	for _, field := range s.Fields {
+		if len(field.DBName) == 0 {
+			continue
+		}
+
+		fieldValue, _ := field.ValueOf(context.Background(), rv)
+
+		encoded, err := json.Marshal(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+
+		result[field.DBName] = encoded
+	}
+
+	return result, nil
+}
+
+// compares database columns of two values of the same model,
+// before is nil for created entities and after is nil for deleted ones
+func Diff(before any, after any) (map[string]FieldChange, error) {
+	if before != nil && after != nil && reflect.Indirect(reflect.ValueOf(before)).Type() != reflect.Indirect(reflect.ValueOf(after)).Type() {
+		return nil, errors.New("history: compared values must be of the same type")
+	}
+
+	beforeColumns, err := columns(before)
+	if err != nil {
+		return nil, err
+	}
+
+	afterColumns, err := columns(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]FieldChange)
+
+	for name, value := range afterColumns {
+		previous, ok := beforeColumns[name]
+		if !ok {
+			previous = json.RawMessage("null")
+		}
+
+		if !bytes.Equal(previous, value) {
+			changes[name] = FieldChange{Before: previous, After: value}
+		}
+	}
+
+	for name, previous := range beforeColumns {
+		if _, ok := afterColumns[name]; !ok {
+			changes[name] = FieldChange{Before: previous, After: json.RawMessage("null")}
+		}
+	}
+
+	return changes, nil
+}
+
+type Change struct {
+	// nil when the change is made by the system itself
+	ActorID *uuid.UUID
+	// user whose data has changed
+	OwnerID  uuid.UUID
+	Entity   string
+	EntityID uuid.UUID
+	Before   any
+	After    any
+}
+
+// stores the change, nothing is stored if no column has changed
+func Record(tx *gorm.DB, change Change) error {
+	operation := OperationUpdate
+
+	switch {
+	case change.Before == nil && change.After == nil:
+		return errors.New("history: either before or after must be set")
+	case change.Before == nil:
+		operation = OperationCreate
+	case change.After == nil:
+		operation = OperationDelete
+	}
+
+	diff, err := Diff(change.Before, change.After)
+	if err != nil {
+		return err
+	}
+
+	if len(diff) == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(diff)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+
+	record := models.ChangeRecord{
+		ActorID:   change.ActorID,
+		OwnerID:   change.OwnerID,
+		Entity:    change.Entity,
+		EntityID:  change.EntityID,
+		Operation: operation,
+		Changes:   jsonb.JSON(encoded),
+	}
+
+	return tx.Create(&record).Error
+}
@@ -0,0 +1,66 @@
+package history
+
+import (
+	"imi/college/internal/models"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDiffReportsOnlyChangedColumns(t *testing.T) {
+	before := models.UserAddress{
+		ID:         uuid.New(),
+		RegionID:   77,
+		TownTypeID: 1,
+		Town:       "Москва",
+		Address:    "ул. Ленина, 1",
+		PostCode:   "101000",
+		// associations aren't columns and must be ignored
+		Region: models.DictRegion{ID: 77, Value: "Москва"},
+	}
+
+	after := before
+	after.Town = "Химки"
+	after.RegionID = 50
+	after.Region = models.DictRegion{}
+
+	diff, err := Diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff) != 2 {
+		t.Fatalf("expected 2 changed columns, got %d: %v", len(diff), diff)
+	}
+
+	town, ok := diff["town"]
+	if !ok {
+		t.Fatal("town change is missing")
+	}
+
+	if string(town.Before) != `"Москва"` || string(town.After) != `"Химки"` {
+		t.Fatalf("unexpected town change: %s -> %s", town.Before, town.After)
+	}
+
+	if _, ok := diff["region_id"]; !ok {
+		t.Fatal("region_id change is missing")
+	}
+}
+
+func TestDiffOfCreatedEntity(t *testing.T) {
+	after := models.UserAddress{Town: "Казань"}
+
+	diff, err := Diff(nil, &after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	town, ok := diff["town"]
+	if !ok {
+		t.Fatal("created entity must report its columns")
+	}
+
+	if string(town.Before) != "null" {
+		t.Fatalf("columns of created entity must have null before value, got %s", town.Before)
+	}
+}
@@ -0,0 +1,30 @@
+package httpx
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// whether Accept-Encoding allows gzip, either by name or by a wildcard
+func AcceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(part, ";")
+
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			quality, err := strconv.ParseFloat(value, 64)
+			if err != nil || quality <= 0 {
+				continue
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,31 @@
+package httpx
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	cases := map[string]bool{
+		"":                      false,
+		"gzip":                  true,
+		"deflate, gzip;q=1.0":   true,
+		"br, GZIP;q=0.5":        true,
+		"gzip;q=0, deflate":     false,
+		"identity":              false,
+		"*":                     true,
+		"deflate, *;q=0.1":      true,
+		"gzip; q=0.000, br":     false,
+		"gzip-compressed, br":   false,
+		"compress, x-gzip;q=.5": false,
+	}
+
+	for header, want := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", header)
+
+		if got := AcceptsGzip(r); got != want {
+			t.Errorf("AcceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
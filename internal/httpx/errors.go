@@ -2,8 +2,10 @@ package httpx
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -143,3 +145,90 @@ func InvalidRequest(cause validator.ValidationErrors) APIError {
 		Details: m,
 	}
 }
+
+func TooManyAttempts(retryAfter time.Duration) APIError {
+	return APIError{
+		Status:  http.StatusTooManyRequests,
+		Message: "Too many failed attempts, try again later",
+		Details: map[string]any{"retryAfter": int(math.Ceil(retryAfter.Seconds()))},
+	}
+}
+
+func TemporarilyLocked(retryAfter time.Duration) APIError {
+	return APIError{
+		Status:  http.StatusLocked,
+		Message: "Too many failed attempts, sign in is temporarily locked",
+		Details: map[string]any{"retryAfter": int(math.Ceil(retryAfter.Seconds()))},
+	}
+}
+
+func TwoFactorRequired() APIError {
+	return APIError{
+		Status:  http.StatusUnauthorized,
+		Message: "Two-factor authentication code required",
+		Details: map[string]any{"twoFactorRequired": true},
+	}
+}
+
+func InvalidTwoFactorCode() APIError {
+	return APIError{
+		Status:  http.StatusUnauthorized,
+		Message: "Invalid two-factor authentication code",
+	}
+}
+
+func TwoFactorEnrollmentRequired() APIError {
+	return APIError{
+		Status:  http.StatusForbidden,
+		Message: "Two-factor authentication must be enabled to access other users' data",
+	}
+}
+
+func ImpersonationForbidden() APIError {
+	return APIError{
+		Status:  http.StatusForbidden,
+		Message: "The action is not allowed while impersonating a user",
+	}
+}
+
+func ConsentRequired() APIError {
+	return APIError{
+		Status:  http.StatusForbidden,
+		Message: "Consent to the current version of personal data processing terms is required",
+	}
+}
+
+func ParentalConsentRequired() APIError {
+	return APIError{
+		Status:  http.StatusForbidden,
+		Message: "Consent of a parent is required for applicants under 18",
+	}
+}
+
+func ConsentTermsUnavailable() APIError {
+	return APIError{
+		Status:  http.StatusServiceUnavailable,
+		Message: "Personal data processing terms are not published yet",
+	}
+}
+
+func GuardianRequired() APIError {
+	return APIError{
+		Status:  http.StatusForbidden,
+		Message: "Applicants under 18 must provide at least one parent or legal guardian",
+	}
+}
+
+func UserEnrolled() APIError {
+	return APIError{
+		Status:  http.StatusConflict,
+		Message: "The user is referenced by an enrollment order and their data is under legal hold",
+	}
+}
+
+func DictionaryEntryInUse() APIError {
+	return APIError{
+		Status:  http.StatusConflict,
+		Message: "The entry is referenced by existing records and can only be retired",
+	}
+}
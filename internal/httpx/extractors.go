@@ -2,12 +2,19 @@ package httpx
 
 import (
 	"fmt"
+	"imi/college/internal/audit"
 	"imi/college/internal/ctx"
+	"imi/college/internal/env"
+	"imi/college/internal/jwt"
 	"imi/college/internal/models"
 	"imi/college/internal/permissions"
 	"imi/college/internal/query"
 	"imi/college/internal/security"
+	"imi/college/internal/sessions"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -15,28 +22,137 @@ import (
 	"gorm.io/gorm"
 )
 
-func GetCurrentUserFromRequest(db *gorm.DB, r *http.Request) (models.User, error) {
+var trustedProxies = sync.OnceValue(env.TrustedProxies)
+
+func isTrustedProxy(proxies []*net.IPNet, addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the address of the client without the port; behind a reverse
+// proxy every request comes from the proxy's address, so requests coming
+// from TRUSTED_PROXIES are attributed to the last address in
+// X-Forwarded-For which isn't one of the proxies
+func ClientIP(r *http.Request) string {
+	return clientIP(r, trustedProxies())
+}
+
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(proxies, host) {
+		return host
+	}
+
+	// clients may send the header themselves, so only addresses
+	// appended by the trusted proxies can be relied on
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(addr) == nil {
+			break
+		}
+
+		if !isTrustedProxy(proxies, addr) {
+			return addr
+		}
+
+		host = addr
+	}
+
+	return host
+}
+
+type Session struct {
+	User models.User
+	// user was restored from a signed token
+	Stateless bool
+	// staff member acting on behalf of the user, if any
+	ImpersonatorID *uuid.UUID
+}
+
+// signer is nil when the server only issues opaque tokens, otherwise
+// signed tokens are verified without querying the database and the
+// session's user only has ID and permissions filled in
+func GetSessionFromRequest(db *gorm.DB, signer *sessions.Signer, r *http.Request) (Session, error) {
 	rawToken, err := security.ExtractToken(r)
 	if err != nil {
-		return models.User{}, err
+		return Session{}, err
+	}
+
+	if signer != nil && jwt.IsJWT(rawToken) {
+		user, claims, err := signer.Verify(rawToken)
+		if err != nil {
+			return Session{}, err
+		}
+
+		session := Session{User: user, Stateless: true}
+
+		if len(claims.Actor) > 0 {
+			actorID, err := uuid.Parse(claims.Actor)
+			if err != nil {
+				return Session{}, jwt.ErrMalformed
+			}
+			session.ImpersonatorID = &actorID
+		}
+
+		return session, nil
 	}
 
-	token, err := query.GetTokenByValue(db, rawToken)
+	token, err := query.GetCachedTokenByValue(db, rawToken)
 	if err != nil {
-		return models.User{}, err
+		return Session{}, err
 	}
 
 	if token.ExpiresAt.Before(time.Now()) {
 		db.Delete(token)
-		return models.User{}, fmt.Errorf("token has expired")
+		query.InvalidateToken(token.Token)
+		return Session{}, fmt.Errorf("token has expired")
 	}
 
-	user, err := query.GetUserByID(db, token.UserID)
+	// impersonation tokens are short-lived on purpose
+	if env.SessionSliding() && token.ImpersonatorID == nil {
+		lastUsedAt := token.LastUsedAt
+
+		err := query.TouchToken(db, &token, env.SessionTTL(), env.SessionTouchInterval(), env.SessionMaxAge())
+		if err != nil {
+			return Session{}, err
+		}
+
+		if !token.LastUsedAt.Equal(lastUsedAt) {
+			query.CacheToken(token)
+		}
+	}
+
+	user, err := query.GetCachedUserByID(db, token.UserID)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{User: user, ImpersonatorID: token.ImpersonatorID}, nil
+}
+
+func GetCurrentUserFromRequest(db *gorm.DB, signer *sessions.Signer, r *http.Request) (models.User, error) {
+	session, err := GetSessionFromRequest(db, signer, r)
 	if err != nil {
 		return models.User{}, err
 	}
 
-	return user, nil
+	return session.User, nil
 }
 
 func GetTargetUserFromPathValue(db *gorm.DB, r *http.Request, param string) (models.User, error) {
@@ -47,20 +163,22 @@ func GetTargetUserFromPathValue(db *gorm.DB, r *http.Request, param string) (mod
 
 	pathValue := chi.URLParam(r, param)
 
-	if pathValue == "@me" {
-		return currentUser, nil
-	}
+	id := currentUser.ID
 
-	id, err := uuid.Parse(pathValue)
-	if err != nil {
-		return models.User{}, err
+	if pathValue != "@me" {
+		id, err = uuid.Parse(pathValue)
+		if err != nil {
+			return models.User{}, err
+		}
 	}
 
-	if id == currentUser.ID {
+	// users restored from signed tokens are partial, so they
+	// have to be loaded like any other user
+	if id == currentUser.ID && !ctx.IsStatelessUser(r) {
 		return currentUser, nil
 	}
 
-	user, err := query.GetUserByID(db, id)
+	user, err := query.GetCachedUserByID(db, id)
 	if err != nil {
 		return models.User{}, err
 	}
@@ -88,10 +206,117 @@ func GetUsersFromPathWithUAC(db *gorm.DB, r *http.Request, param string, require
 	}
 
 	if targetUser.ID != currentUser.ID {
-		if !permissions.HasPermissions(currentUser.Permissions, required) {
+		if !permissions.HasPermissions(currentUser.EffectivePermissions(), required) {
 			return models.User{}, models.User{}, Forbidden()
 		}
+
+		if err := CheckStaffTwoFactor(db, currentUser); err != nil {
+			return models.User{}, models.User{}, err
+		}
+
+		if err := CheckStaffScope(db, currentUser, targetUser, required); err != nil {
+			return models.User{}, models.User{}, err
+		}
+
+		// access which can't be audited is refused
+		if err := RecordAccess(db, r, currentUser.ID, targetUser.ID); err != nil {
+			return models.User{}, models.User{}, err
+		}
 	}
 
 	return currentUser, targetUser, nil
 }
+
+// if the policy requires staff to use 2FA, makes sure the user
+// holding elevated permissions has finished 2FA enrollment
+func CheckStaffTwoFactor(db *gorm.DB, user models.User) error {
+	if !env.TwoFactorRequiredForStaff() || !permissions.IsElevated(user.EffectivePermissions()) {
+		return nil
+	}
+
+	enrolled, err := query.HasTwoFactor(db, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if !enrolled {
+		return TwoFactorEnrollmentRequired()
+	}
+
+	return nil
+}
+
+// staff limited to certain majors can only access applicants
+// who have applied to at least one of those majors; staff filing
+// applications can also reach applicants who haven't applied yet,
+// the major of the new application is checked against the scope
+func CheckStaffScope(db *gorm.DB, staff models.User, target models.User, required int64) error {
+	if permissions.HasAdmin(staff.EffectivePermissions()) {
+		return nil
+	}
+
+	allowUnapplied := required == permissions.PermissionEditApplications
+
+	allowed, err := query.IsWithinStaffScope(db, staff.ID, target.ID, allowUnapplied)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return Forbidden()
+	}
+
+	return nil
+}
+
+// records actor accessing target's data through the request
+func RecordAccess(db *gorm.DB, r *http.Request, actorID uuid.UUID, targetID uuid.UUID) error {
+	resource := r.URL.Path
+	if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil {
+		resource = routeCtx.RoutePattern()
+	}
+
+	return audit.Record(db, models.AuditEntry{
+		ActorID:  actorID,
+		TargetID: targetID,
+		Action:   audit.ActionFromMethod(r.Method),
+		Resource: resource,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		IP:       ClientIP(r),
+	})
+}
+
+// records a request made by a staff member impersonating the user,
+// meant to be called before routing is finished, so the route
+// pattern is resolved from the router itself
+func RecordImpersonation(db *gorm.DB, r *http.Request, impersonatorID uuid.UUID, userID uuid.UUID) error {
+	resource := r.URL.Path
+	if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil && routeCtx.Routes != nil {
+		probe := chi.NewRouteContext()
+		if routeCtx.Routes.Match(probe, r.Method, r.URL.Path) {
+			resource = probe.RoutePattern()
+		}
+	}
+
+	return audit.Record(db, models.AuditEntry{
+		ActorID:      impersonatorID,
+		TargetID:     userID,
+		Action:       audit.ActionFromMethod(r.Method),
+		Resource:     resource,
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		IP:           ClientIP(r),
+		Impersonated: true,
+	})
+}
+
+// returns the id of whoever actually makes the request, which is
+// the staff member rather than the user they impersonate
+func GetActorID(r *http.Request, currentUser models.User) uuid.UUID {
+	if impersonatorID, ok := ctx.GetImpersonator(r); ok {
+		return impersonatorID
+	}
+
+	return currentUser.ID
+}
@@ -0,0 +1,40 @@
+package httpx
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	_, proxy, _ := net.ParseCIDR("10.0.0.0/8")
+	proxies := []*net.IPNet{proxy}
+
+	cases := []struct {
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"203.0.113.7:5000", "", "203.0.113.7"},
+		// only trusted proxies may set the client's address
+		{"203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+		// addresses before the one the proxy has seen are made up by the client
+		{"10.0.0.2:5000", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"10.0.0.2:5000", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"10.0.0.2:5000", "", "10.0.0.2"},
+		{"10.0.0.2:5000", "garbage", "10.0.0.2"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		if len(c.forwarded) > 0 {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+
+		if actual := clientIP(r, proxies); actual != c.want {
+			t.Errorf("unexpected address for %q from %s:\nactual: %s\nexpected: %s\n", c.forwarded, c.remoteAddr, actual, c.want)
+		}
+	}
+}
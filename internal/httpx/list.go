@@ -0,0 +1,21 @@
+package httpx
+
+import (
+	"errors"
+	"imi/college/internal/query"
+	"net/http"
+)
+
+// parses list parameters of the request, invalid ones are reported as bad requests
+func ParseList(r *http.Request, spec query.ListSpec) (query.List, error) {
+	list, err := query.ParseList(r.URL.Query(), spec)
+	if err != nil {
+		var paramErr query.ListParamError
+		if errors.As(err, &paramErr) {
+			return query.List{}, BadRequest(paramErr.Error())
+		}
+		return query.List{}, err
+	}
+
+	return list, nil
+}
@@ -0,0 +1,88 @@
+package httpx
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// picks the locale from ?lang= or else from Accept-Language, tags are
+// matched by their primary language subtag, so "en-GB" matches "en"
+func GetLocale(r *http.Request, supported []string, fallback string) string {
+	if lang := r.URL.Query().Get("lang"); len(lang) > 0 {
+		if locale, ok := matchLocale(lang, supported); ok {
+			return locale
+		}
+	}
+
+	for _, tag := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if tag == "*" {
+			return fallback
+		}
+
+		if locale, ok := matchLocale(tag, supported); ok {
+			return locale
+		}
+	}
+
+	return fallback
+}
+
+func matchLocale(tag string, supported []string) (string, bool) {
+	primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+	for _, locale := range supported {
+		if locale == primary {
+			return locale, true
+		}
+	}
+
+	return "", false
+}
+
+// language tags ordered by their quality, tags with zero quality are dropped
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	var tags []weighted
+
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 {
+			continue
+		}
+
+		quality := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if quality <= 0 {
+			continue
+		}
+
+		tags = append(tags, weighted{tag, quality})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].quality > tags[j].quality
+	})
+
+	result := make([]string, len(tags))
+	for i, tag := range tags {
+		result[i] = tag.tag
+	}
+
+	return result
+}
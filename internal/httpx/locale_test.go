@@ -0,0 +1,37 @@
+package httpx
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetLocale(t *testing.T) {
+	supported := []string{"ru", "en"}
+
+	cases := []struct {
+		url            string
+		acceptLanguage string
+		want           string
+	}{
+		{"/", "", "ru"},
+		{"/", "en-US,en;q=0.9", "en"},
+		{"/", "de-DE, en;q=0.5, ru;q=0.8", "ru"},
+		{"/", "de, fr;q=0.5", "ru"},
+		{"/", "en;q=0, ru", "ru"},
+		{"/", "de, *;q=0.5, en;q=0.1", "ru"},
+		{"/?lang=en", "ru", "en"},
+		{"/?lang=EN-gb", "", "en"},
+		{"/?lang=de", "en", "en"},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.url, nil)
+		if len(c.acceptLanguage) > 0 {
+			r.Header.Set("Accept-Language", c.acceptLanguage)
+		}
+
+		if got := GetLocale(r, supported, "ru"); got != c.want {
+			t.Errorf("GetLocale(%q, %q) = %q, want %q", c.url, c.acceptLanguage, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMalformed    = errors.New("token is malformed")
+	ErrUnknownKey   = errors.New("token is signed with unknown key")
+	ErrBadSignature = errors.New("token signature is invalid")
+	ErrExpired      = errors.New("token has expired")
+)
+
+// keys shorter than the output of SHA-256 weaken HS256
+const MinKeySize = 32
+
+var encoding = base64.RawURLEncoding
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+type Claims struct {
+	ID          string `json:"jti"`
+	Subject     string `json:"sub"`
+	Permissions int64  `json:"perms"`
+	// id of the refresh token family the token was issued with
+	Family string `json:"fam,omitempty"`
+	// id of the staff member impersonating the subject
+	Actor     string `json:"act,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// set of HS256 keys, the first key signs new tokens while all of them
+// are accepted, so issued tokens stay valid through a key rotation
+type KeyRing struct {
+	keys []Key
+}
+
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key ring requires at least one key")
+	}
+
+	for _, key := range keys {
+		if len(key.ID) == 0 {
+			return nil, errors.New("key id cannot be empty")
+		}
+
+		if len(key.Secret) < MinKeySize {
+			return nil, fmt.Errorf("key %s must be at least %d bytes long", key.ID, MinKeySize)
+		}
+	}
+
+	return &KeyRing{keys: keys}, nil
+}
+
+// parses keys in the form "id1:base64secret,id2:base64secret"
+func ParseKeyRing(value string) (*KeyRing, error) {
+	var keys []Key
+
+	for _, entry := range strings.Split(value, ",") {
+		id, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found {
+			return nil, fmt.Errorf("key entry %q must be in the form id:secret", entry)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %s is not valid base64: %w", id, err)
+		}
+
+		keys = append(keys, Key{ID: id, Secret: secret})
+	}
+
+	return NewKeyRing(keys...)
+}
+
+func (k *KeyRing) find(id string) (Key, bool) {
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+
+	return Key{}, false
+}
+
+func sign(secret []byte, data string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+
+	return encoding.EncodeToString(mac.Sum(nil))
+}
+
+func (k *KeyRing) Sign(claims Claims) (string, error) {
+	key := k.keys[0]
+
+	rawHeader, err := json.Marshal(header{Algorithm: "HS256", Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	rawClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	data := encoding.EncodeToString(rawHeader) + "." + encoding.EncodeToString(rawClaims)
+
+	return data + "." + sign(key.Secret, data), nil
+}
+
+func (k *KeyRing) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+
+	rawHeader, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	// the algorithm is fixed, tokens claiming anything else are refused
+	if h.Algorithm != "HS256" {
+		return Claims{}, ErrMalformed
+	}
+
+	key, ok := k.find(h.KeyID)
+	if !ok {
+		return Claims{}, ErrUnknownKey
+	}
+
+	expected := sign(key.Secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return Claims{}, ErrBadSignature
+	}
+
+	rawClaims, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpired
+	}
+
+	return claims, nil
+}
+
+// opaque tokens are standard base64 which never contains dots,
+// so anything made of three dot separated parts is a JWT
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// in-memory set of revoked ids, so checking a token doesn't
+// require a database round trip
+type RevocationList struct {
+	mu       sync.RWMutex
+	ids      map[string]time.Time
+	subjects map[string]SubjectRevocation
+}
+
+// tokens of the subject issued up to IssuedBefore are revoked,
+// the entry is needed until ExpiresAt
+type SubjectRevocation struct {
+	IssuedBefore time.Time
+	ExpiresAt    time.Time
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		ids:      make(map[string]time.Time),
+		subjects: make(map[string]SubjectRevocation),
+	}
+}
+
+func (l *RevocationList) Add(id string, expiresAt time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ids[id] = expiresAt
+}
+
+func (l *RevocationList) Contains(id string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.ids[id]
+	return ok
+}
+
+// the latest revocation of the subject wins
+func (l *RevocationList) AddSubject(subject string, revocation SubjectRevocation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.addSubject(subject, revocation)
+}
+
+func (l *RevocationList) addSubject(subject string, revocation SubjectRevocation) {
+	current, ok := l.subjects[subject]
+	if !ok {
+		l.subjects[subject] = revocation
+		return
+	}
+
+	if revocation.IssuedBefore.After(current.IssuedBefore) {
+		current.IssuedBefore = revocation.IssuedBefore
+	}
+
+	if revocation.ExpiresAt.After(current.ExpiresAt) {
+		current.ExpiresAt = revocation.ExpiresAt
+	}
+
+	l.subjects[subject] = current
+}
+
+// issuedAt has a precision of seconds, so tokens issued within the
+// second of the revocation are revoked as well
+func (l *RevocationList) ContainsSubject(subject string, issuedAt int64) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	revocation, ok := l.subjects[subject]
+	return ok && issuedAt <= revocation.IssuedBefore.Unix()
+}
+
+// merges ids loaded from the shared storage, so revocations made by
+// other replicas are picked up; entries which have expired are dropped
+func (l *RevocationList) Merge(ids map[string]time.Time, subjects map[string]SubjectRevocation, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for id, expiresAt := range l.ids {
+		if !expiresAt.After(now) {
+			delete(l.ids, id)
+		}
+	}
+
+	for id, expiresAt := range ids {
+		l.ids[id] = expiresAt
+	}
+
+	for subject, revocation := range l.subjects {
+		if !revocation.ExpiresAt.After(now) {
+			delete(l.subjects, subject)
+		}
+	}
+
+	for subject, revocation := range subjects {
+		l.addSubject(subject, revocation)
+	}
+}
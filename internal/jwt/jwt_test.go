@@ -0,0 +1,133 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestKey(id string, fill byte) Key {
+	return Key{ID: id, Secret: bytes.Repeat([]byte{fill}, MinKeySize)}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	ring, err := NewKeyRing(newTestKey("a", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := Claims{ID: "token", Subject: "user", Permissions: 5, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+
+	token, err := ring.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsJWT(token) {
+		t.Fatal("signed token must look like a JWT")
+	}
+
+	actual, err := ring.Verify(token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual != claims {
+		t.Fatalf("verified claims don't match:\nactual: %+v\nexpected: %+v\n", actual, claims)
+	}
+
+	if _, err := ring.Verify(token, now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+
+	tampered := token[:len(token)-2] + "AA"
+	if _, err := ring.Verify(tampered, now); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+}
+
+func TestRotationKeepsOldTokensValid(t *testing.T) {
+	oldRing, err := NewKeyRing(newTestKey("old", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	token, err := oldRing.Sign(Claims{ID: "token", ExpiresAt: now.Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewKeyRing(newTestKey("new", 2), newTestKey("old", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rotated.Verify(token, now); err != nil {
+		t.Fatalf("token signed with a previous key must stay valid: %v", err)
+	}
+
+	retired, err := NewKeyRing(newTestKey("new", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := retired.Verify(token, now); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestParseKeyRing(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, MinKeySize))
+
+	ring, err := ParseKeyRing("k2:" + secret + ", k1:" + secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ring.keys) != 2 || ring.keys[0].ID != "k2" {
+		t.Fatal("keys must be parsed in order")
+	}
+
+	if _, err := ParseKeyRing("short:" + base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Fatal("short keys must be refused")
+	}
+}
+
+func TestSubjectRevocation(t *testing.T) {
+	now := time.Now()
+	list := NewRevocationList()
+
+	list.AddSubject("user", SubjectRevocation{IssuedBefore: now, ExpiresAt: now.Add(time.Hour)})
+
+	if !list.ContainsSubject("user", now.Add(-time.Minute).Unix()) || !list.ContainsSubject("user", now.Unix()) {
+		t.Fatal("tokens issued up to the revocation must be revoked")
+	}
+
+	if list.ContainsSubject("user", now.Add(time.Second).Unix()) {
+		t.Fatal("tokens issued after the revocation must stay valid")
+	}
+
+	if list.ContainsSubject("another", now.Unix()) {
+		t.Fatal("tokens of other subjects must stay valid")
+	}
+
+	// an earlier revocation loaded from another replica doesn't undo a later one
+	list.Merge(nil, map[string]SubjectRevocation{
+		"user": {IssuedBefore: now.Add(-time.Hour), ExpiresAt: now.Add(time.Minute)},
+	}, now)
+
+	if !list.ContainsSubject("user", now.Unix()) {
+		t.Fatal("the latest revocation must win")
+	}
+
+	list.Merge(nil, nil, now.Add(2*time.Hour))
+
+	if list.ContainsSubject("user", now.Unix()) {
+		t.Fatal("expired revocations must be dropped")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"imi/college/internal/ctx"
 	"imi/college/internal/httpx"
 	"imi/college/internal/permissions"
+	"imi/college/internal/sessions"
 	"imi/college/internal/writer"
 	"net/http"
 
@@ -16,16 +17,31 @@ func writeError(w http.ResponseWriter) {
 	writer.JSON(w, data.Status, data)
 }
 
-func RequireUser(db *gorm.DB) func(next http.Handler) http.Handler {
+func RequireUser(db *gorm.DB, signer *sessions.Signer) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			user, err := httpx.GetCurrentUserFromRequest(db, r)
+			session, err := httpx.GetSessionFromRequest(db, signer, r)
 			if err != nil {
 				writeError(w)
 				return
 			}
 
-			c := context.WithValue(r.Context(), ctx.UserKey, user)
+			c := context.WithValue(r.Context(), ctx.UserKey, session.User)
+
+			if session.Stateless {
+				c = context.WithValue(c, ctx.StatelessKey, true)
+			}
+
+			if session.ImpersonatorID != nil {
+				// impersonated requests which can't be audited are refused
+				if err := httpx.RecordImpersonation(db, r, *session.ImpersonatorID, session.User.ID); err != nil {
+					data := httpx.APIError{Status: http.StatusInternalServerError, Message: "Internal Server Error"}
+					writer.JSON(w, data.Status, data)
+					return
+				}
+
+				c = context.WithValue(c, ctx.ImpersonatorKey, *session.ImpersonatorID)
+			}
 
 			next.ServeHTTP(w, r.WithContext(c))
 		}
@@ -34,12 +50,27 @@ func RequireUser(db *gorm.DB) func(next http.Handler) http.Handler {
 	}
 }
 
+// refuses destructive actions to staff impersonating a user
+func DenyImpersonated(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if _, impersonated := ctx.GetImpersonator(r); impersonated {
+			data := httpx.ImpersonationForbidden()
+			writer.JSON(w, data.Status, data)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
 func writeBadPermissions(w http.ResponseWriter) {
 	data := httpx.Forbidden()
 	writer.JSON(w, data.Status, data)
 }
 
-func RequirePermissions(required int64) func(next http.Handler) http.Handler {
+func RequirePermissions(db *gorm.DB, required int64) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			user, err := ctx.GetCurrentUser(r)
@@ -48,17 +79,21 @@ func RequirePermissions(required int64) func(next http.Handler) http.Handler {
 				return
 			}
 
-			if permissions.HasPermissions(user.Permissions, permissions.PermissionAdmin) {
-				next.ServeHTTP(w, r)
+			if !permissions.HasPermissions(user.EffectivePermissions(), required) {
+				writeBadPermissions(w)
 				return
 			}
 
-			if permissions.HasPermissions(user.Permissions, required) {
-				next.ServeHTTP(w, r)
+			if err := httpx.CheckStaffTwoFactor(db, user); err != nil {
+				apiErr, ok := err.(httpx.APIError)
+				if !ok {
+					apiErr = httpx.APIError{Status: http.StatusInternalServerError, Message: "Internal Server Error"}
+				}
+				writer.JSON(w, apiErr.Status, apiErr)
 				return
 			}
 
-			writeBadPermissions(w)
+			next.ServeHTTP(w, r)
 		}
 
 		return http.HandlerFunc(fn)
@@ -0,0 +1,123 @@
+package migrations
+
+import (
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"imi/college/internal/roles"
+
+	"gorm.io/gorm"
+)
+
+// migrations written in Go, for changes plain SQL can't express
+var goMigrations = []Migration{
+	{
+		Version: 7,
+		Name:    "legacy_permissions_to_roles",
+		Up:      migrateLegacyPermissions,
+		// roles are kept, users aren't moved back to raw permission bits
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 23,
+		Name:    "applicant_role_backfill",
+		Up:      backfillApplicantRole,
+		// backfilled roles can't be told apart from the ones given on registration
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+}
+
+// name the migration was recorded under before schema migrations existed
+const legacyDataMigrationName = "legacy-permissions-to-roles"
+
+// moves users off the raw permission bits they had before roles existed
+//
+// before per resource permissions existed, viewing and editing a user
+// also covered their applications and documents, so those users get
+// the matching per resource bits; admins are given the admin role
+func migrateLegacyPermissions(tx *gorm.DB) error {
+	// data_migrations used to record one-off migrations, it's replaced by
+	// schema_migrations and only consulted to skip what was already done
+	var done int64
+
+	if tx.Migrator().HasTable("data_migrations") {
+		if err := tx.Table("data_migrations").Where("name = ?", legacyDataMigrationName).Count(&done).Error; err != nil {
+			return err
+		}
+	}
+
+	if done == 0 {
+		if err := moveLegacyPermissions(tx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Migrator().DropTable("data_migrations")
+}
+
+func moveLegacyPermissions(tx *gorm.DB) error {
+	expansions := map[int64]int64{
+		permissions.PermissionViewUser: permissions.PermissionViewApplications | permissions.PermissionViewDocuments,
+		permissions.PermissionEditUser: permissions.PermissionEditApplications | permissions.PermissionEditDocuments,
+	}
+
+	for legacy, expanded := range expansions {
+		if err := tx.
+			Model(&models.User{}).
+			Where("permissions & ? <> 0", legacy).
+			UpdateColumn("permissions", gorm.Expr("permissions | ?", expanded)).
+			Error; err != nil {
+			return err
+		}
+	}
+
+	var admins []models.User
+
+	if err := tx.Where("permissions & ? <> 0", permissions.PermissionAdmin).Find(&admins).Error; err != nil {
+		return err
+	}
+
+	if len(admins) == 0 {
+		return nil
+	}
+
+	if err := roles.EnsureDefaults(tx); err != nil {
+		return err
+	}
+
+	var admin models.Role
+
+	if err := tx.Where(&models.Role{Name: permissions.RoleAdmin}).First(&admin).Error; err != nil {
+		return err
+	}
+
+	for _, user := range admins {
+		if err := tx.Model(&user).Association("Roles").Append(&admin); err != nil {
+			return err
+		}
+
+		if err := tx.
+			Model(&user).
+			UpdateColumn("permissions", gorm.Expr("permissions & ~?::bigint", permissions.PermissionAdmin)).
+			Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// users registered before roles existed got none, while registration now
+// gives every user the applicant role, so the ones left without any role
+// get it as well
+func backfillApplicantRole(tx *gorm.DB) error {
+	if err := roles.EnsureDefaults(tx); err != nil {
+		return err
+	}
+
+	return tx.Exec(`
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT users.id, roles.id FROM users, roles
+		WHERE roles.name = ? AND NOT EXISTS (
+			SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id
+		)`, permissions.RoleApplicant).Error
+}
@@ -0,0 +1,327 @@
+package migrations
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"imi/college/internal/models"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// changes the schema from the previous version to Version, every
+// migration runs in its own transaction along with its record
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// nil for migrations which can't be reverted
+	Down func(tx *gorm.DB) error
+}
+
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt"`
+	// applied by a newer build, this one doesn't know how to revert it
+	Unknown bool `json:"unknown"`
+}
+
+var (
+	ErrIrreversible = errors.New("migrations: migration can't be reverted")
+	ErrUnknown      = errors.New("migrations: database has a migration unknown to this build")
+)
+
+const baselineVersion = 1
+
+// key of the advisory lock held while migrating, so replicas
+// started at the same time don't apply migrations concurrently
+const lockKey int64 = 0x696d69636f6c6c
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// files are named like 0002_add_something.up.sql and 0002_add_something.down.sql
+var filePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+func execFile(name string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		statements, err := fs.ReadFile(files, path.Join("sql", name))
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(string(statements)).Error
+	}
+}
+
+// every known migration ordered by version
+func All() ([]Migration, error) {
+	byVersion := make(map[int64]*Migration)
+
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		match := filePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrations: unexpected file sql/%s", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations: version %d has files named %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = execFile(entry.Name())
+		} else {
+			m.Down = execFile(entry.Name())
+		}
+	}
+
+	for _, m := range goMigrations {
+		if _, ok := byVersion[m.Version]; ok {
+			return nil, fmt.Errorf("migrations: version %d is defined twice", m.Version)
+		}
+		m := m
+		byVersion[m.Version] = &m
+	}
+
+	all := make([]Migration, 0, len(byVersion))
+
+	for _, m := range byVersion {
+		if m.Up == nil {
+			return nil, fmt.Errorf("migrations: version %d has no up migration", m.Version)
+		}
+		all = append(all, *m)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Version < all[j].Version
+	})
+
+	return all, nil
+}
+
+// runs fn on a single connection holding the migrations lock
+func withLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", lockKey)
+
+		if err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint NOT NULL,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now(),
+			PRIMARY KEY (version)
+		)`).Error; err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+func applied(conn *gorm.DB) (map[int64]models.SchemaMigration, error) {
+	var records []models.SchemaMigration
+
+	if err := conn.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]models.SchemaMigration, len(records))
+	for _, record := range records {
+		result[record.Version] = record
+	}
+
+	return result, nil
+}
+
+// databases created by gorm's AutoMigrate before migrations existed
+// have at least the first release's schema, so the baseline is recorded
+// without running; the migrations after it only create what's missing
+func adoptBaseline(conn *gorm.DB, all []Migration, records map[int64]models.SchemaMigration) error {
+	if len(records) > 0 || len(all) == 0 || all[0].Version != baselineVersion {
+		return nil
+	}
+
+	var exists bool
+
+	if err := conn.Raw("SELECT to_regclass('users') IS NOT NULL").Scan(&exists).Error; err != nil {
+		return err
+	}
+
+	if !exists {
+		return nil
+	}
+
+	record := models.SchemaMigration{Version: all[0].Version, Name: all[0].Name, AppliedAt: time.Now()}
+
+	if err := conn.Create(&record).Error; err != nil {
+		return err
+	}
+
+	records[record.Version] = record
+
+	return nil
+}
+
+// applies every pending migration, returns the applied ones
+func Up(db *gorm.DB) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+
+	err = withLock(db, func(conn *gorm.DB) error {
+		records, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		if err := adoptBaseline(conn, all, records); err != nil {
+			return err
+		}
+
+		for _, m := range all {
+			if _, ok := records[m.Version]; ok {
+				continue
+			}
+
+			txFn := func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return fmt.Errorf("migrations: %d_%s: %w", m.Version, m.Name, err)
+				}
+
+				return tx.Create(&models.SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			}
+
+			if err := conn.Transaction(txFn); err != nil {
+				return err
+			}
+
+			done = append(done, m)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// reverts the given number of the latest applied migrations,
+// returns the reverted ones
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]Migration, len(all))
+	for _, m := range all {
+		known[m.Version] = m
+	}
+
+	var done []Migration
+
+	err = withLock(db, func(conn *gorm.DB) error {
+		var records []models.SchemaMigration
+
+		if err := conn.Order("version DESC").Limit(steps).Find(&records).Error; err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			m, ok := known[record.Version]
+			if !ok {
+				return fmt.Errorf("%w: %d_%s", ErrUnknown, record.Version, record.Name)
+			}
+
+			if m.Down == nil {
+				return fmt.Errorf("%w: %d_%s", ErrIrreversible, m.Version, m.Name)
+			}
+
+			txFn := func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return fmt.Errorf("migrations: %d_%s: %w", m.Version, m.Name, err)
+				}
+
+				return tx.Delete(&models.SchemaMigration{}, m.Version).Error
+			}
+
+			if err := conn.Transaction(txFn); err != nil {
+				return err
+			}
+
+			done = append(done, m)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// known and applied migrations ordered by version
+func GetStatus(db *gorm.DB) ([]Status, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Status
+
+	err = withLock(db, func(conn *gorm.DB) error {
+		records, err := applied(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range all {
+			status := Status{Version: m.Version, Name: m.Name}
+
+			if record, ok := records[m.Version]; ok {
+				status.AppliedAt = &record.AppliedAt
+				delete(records, m.Version)
+			}
+
+			result = append(result, status)
+		}
+
+		for _, record := range records {
+			record := record
+			result = append(result, Status{Version: record.Version, Name: record.Name, AppliedAt: &record.AppliedAt, Unknown: true})
+		}
+
+		return nil
+	})
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, err
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) == 0 || all[0].Version != baselineVersion {
+		t.Fatalf("first migration must be the baseline")
+	}
+
+	for i, m := range all {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: versions must go one after another, want %d", m.Version, m.Name, i+1)
+		}
+
+		if m.Down == nil {
+			t.Errorf("migration %d_%s has no down migration", m.Version, m.Name)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS
+	education_docs,
+	identity_docs,
+	applications,
+	user_files,
+	user_addresses,
+	user_details,
+	doc_statuses,
+	college_majors,
+	dict_genders,
+	dict_town_types,
+	dict_regions,
+	dict_nationalities,
+	dict_edu_levels,
+	dict_id_doc_types,
+	dict_edu_doc_types,
+	dict_app_statuses,
+	user_tokens,
+	passwords,
+	users;
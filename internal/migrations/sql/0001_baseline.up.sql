@@ -0,0 +1,212 @@
+-- schema of the first release, created by gorm's AutoMigrate back then,
+-- databases created that way get this migration recorded without running
+-- it; every later change is a migration of its own
+
+CREATE TABLE users (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	user_name text NOT NULL,
+	email text NOT NULL,
+	is_verified boolean NOT NULL DEFAULT false,
+	permissions bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX idx_users_user_name ON users (user_name);
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+CREATE TABLE passwords (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	hash text NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_passwords_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_passwords_user_id ON passwords (user_id);
+
+CREATE TABLE user_tokens (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	expires_at timestamptz NOT NULL DEFAULT now() + interval '2 days',
+	token text NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_user_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_user_tokens_token ON user_tokens (token);
+
+CREATE TABLE dict_app_statuses (
+	id bigint NOT NULL,
+	is_default boolean NOT NULL DEFAULT false,
+	value text NOT NULL,
+	display_value text,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE dict_edu_doc_types (
+	id bigint NOT NULL,
+	value text NOT NULL,
+	display_value text,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE dict_id_doc_types (
+	id bigint NOT NULL,
+	value text NOT NULL,
+	display_value text,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE dict_edu_levels (
+	id bigint NOT NULL,
+	value text NOT NULL,
+	display_value text,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE dict_nationalities (
+	id bigint NOT NULL,
+	value text NOT NULL,
+	display_value text,
+	sort_priority bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE dict_regions (
+	id bigint NOT NULL,
+	region_id bigint NOT NULL,
+	value text NOT NULL,
+	display_value text,
+	sort_priority bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX idx_dict_regions_region_id ON dict_regions (region_id);
+
+CREATE TABLE dict_town_types (
+	id bigint NOT NULL,
+	value text NOT NULL,
+	display_value text,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE dict_genders (
+	id bigint NOT NULL,
+	value text NOT NULL,
+	display_value text,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE college_majors (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	name text NOT NULL,
+	prefix text NOT NULL,
+	base text NOT NULL,
+	name_official text NOT NULL,
+	budget boolean NOT NULL DEFAULT false,
+	code text NOT NULL,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE doc_statuses (
+	id bigint NOT NULL,
+	is_default boolean NOT NULL DEFAULT false,
+	value text NOT NULL,
+	display_value text,
+	PRIMARY KEY (id)
+);
+
+CREATE TABLE user_details (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	first_name text NOT NULL,
+	middle_name text NOT NULL,
+	last_name text,
+	gender_id bigint NOT NULL,
+	birthday date NOT NULL,
+	tel text NOT NULL,
+	snils text,
+	needs_dorm boolean NOT NULL DEFAULT false,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_users_details FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_user_details_gender FOREIGN KEY (gender_id) REFERENCES dict_genders (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_user_details_user_id ON user_details (user_id);
+
+CREATE TABLE user_addresses (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	region_id bigint NOT NULL,
+	town_type_id bigint NOT NULL,
+	town text NOT NULL,
+	address text NOT NULL,
+	post_code text NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_users_address FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_user_addresses_region FOREIGN KEY (region_id) REFERENCES dict_regions (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_user_addresses_town_type FOREIGN KEY (town_type_id) REFERENCES dict_town_types (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX idx_user_addresses_user_id ON user_addresses (user_id);
+
+-- sha256 had a malformed tag, so it ended up nullable and without an index
+CREATE TABLE user_files (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	sha256 text,
+	user_id uuid NOT NULL,
+	mime_type text NOT NULL,
+	absolute_path text NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_user_files_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE applications (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	user_id uuid NOT NULL,
+	major_id uuid NOT NULL,
+	edu_level_id bigint NOT NULL,
+	status_id bigint NOT NULL,
+	priority smallint NOT NULL DEFAULT 1,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_applications_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_applications_major FOREIGN KEY (major_id) REFERENCES college_majors (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_applications_edu_level FOREIGN KEY (edu_level_id) REFERENCES dict_edu_levels (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_applications_status FOREIGN KEY (status_id) REFERENCES dict_app_statuses (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE identity_docs (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	user_id uuid NOT NULL,
+	status_id bigint,
+	type_id bigint NOT NULL,
+	series text NOT NULL,
+	number text NOT NULL,
+	issuer text NOT NULL,
+	issued_at date NOT NULL,
+	division_code text NOT NULL,
+	nationality_id bigint NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_identity_docs_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_identity_docs_status FOREIGN KEY (status_id) REFERENCES doc_statuses (id) ON UPDATE CASCADE ON DELETE SET NULL,
+	CONSTRAINT fk_identity_docs_type FOREIGN KEY (type_id) REFERENCES dict_id_doc_types (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_identity_docs_nationality FOREIGN KEY (nationality_id) REFERENCES dict_nationalities (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE education_docs (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	user_id uuid NOT NULL,
+	status_id bigint,
+	type_id bigint NOT NULL,
+	series text NOT NULL,
+	number text NOT NULL,
+	issuer text NOT NULL,
+	issued_at date NOT NULL,
+	grad_year smallint NOT NULL,
+	issuer_region_id bigint NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_education_docs_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_education_docs_status FOREIGN KEY (status_id) REFERENCES doc_statuses (id) ON UPDATE CASCADE ON DELETE SET NULL,
+	CONSTRAINT fk_education_docs_type FOREIGN KEY (type_id) REFERENCES dict_edu_doc_types (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_education_docs_issuer_region FOREIGN KEY (issuer_region_id) REFERENCES dict_regions (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
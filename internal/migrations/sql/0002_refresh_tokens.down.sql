@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS refresh_tokens;
+
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS last_used_at;
@@ -0,0 +1,21 @@
+-- migrations up to 0017 followed changes made by AutoMigrate, databases
+-- it brought past the first release already have some of their objects
+
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS last_used_at timestamptz NOT NULL DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	family_id uuid NOT NULL,
+	access_token_id uuid,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	expires_at timestamptz NOT NULL,
+	used_at timestamptz,
+	revoked_at timestamptz,
+	token text NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_refresh_tokens_access_token FOREIGN KEY (access_token_id) REFERENCES user_tokens (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token ON refresh_tokens (token);
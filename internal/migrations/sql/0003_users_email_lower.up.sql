@@ -0,0 +1,24 @@
+-- emails are unique regardless of their case
+
+-- the previous index was case sensitive, so users whose emails only differ
+-- in case have to be sorted out by hand before the index can be created
+DO $$
+DECLARE
+	conflicts text;
+BEGIN
+	SELECT string_agg(emails, '; ') INTO conflicts FROM (
+		SELECT string_agg(email, ', ' ORDER BY email) AS emails
+		FROM users
+		WHERE email IS NOT NULL
+		GROUP BY lower(email)
+		HAVING count(*) > 1
+	) duplicates;
+
+	IF conflicts IS NOT NULL THEN
+		-- the hint isn't shown by the driver's error, so everything is in the message
+		RAISE EXCEPTION 'users have emails which only differ in case: %; change the emails or erase the extra users so every email is used once regardless of case, then run migrate up again', conflicts;
+	END IF;
+END $$;
+
+DROP INDEX IF EXISTS idx_users_email;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (lower(email));
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS user_totps (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	confirmed_at timestamptz,
+	secret text NOT NULL,
+	last_used_step bigint NOT NULL DEFAULT 0,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_user_totps_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_totps_user_id ON user_totps (user_id);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	hash text NOT NULL,
+	used_at timestamptz,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS roles (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	name text NOT NULL,
+	display_name text NOT NULL,
+	permissions bigint NOT NULL DEFAULT 0,
+	is_system boolean NOT NULL DEFAULT false,
+	PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_name ON roles (name);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+	user_id uuid NOT NULL,
+	role_id uuid NOT NULL,
+	PRIMARY KEY (user_id, role_id),
+	CONSTRAINT fk_user_roles_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_user_roles_role FOREIGN KEY (role_id) REFERENCES roles (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS staff_scopes (
+	user_id uuid NOT NULL,
+	major_id uuid NOT NULL,
+	PRIMARY KEY (user_id, major_id),
+	CONSTRAINT fk_staff_scopes_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_staff_scopes_major FOREIGN KEY (major_id) REFERENCES college_majors (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS change_records (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	actor_id uuid,
+	owner_id uuid NOT NULL,
+	entity text NOT NULL,
+	entity_id uuid NOT NULL,
+	operation text NOT NULL,
+	changes jsonb NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_change_records_owner_id ON change_records (owner_id);
+CREATE INDEX IF NOT EXISTS idx_change_records_entity ON change_records (entity, entity_id);
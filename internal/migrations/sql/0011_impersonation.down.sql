@@ -0,0 +1,3 @@
+ALTER TABLE audit_entries DROP COLUMN IF EXISTS impersonated;
+
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS impersonator_id;
@@ -0,0 +1,12 @@
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS impersonator_id uuid;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_user_tokens_impersonator') THEN
+		ALTER TABLE user_tokens ADD CONSTRAINT fk_user_tokens_impersonator
+			FOREIGN KEY (impersonator_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE;
+	END IF;
+END
+$$;
+
+ALTER TABLE audit_entries ADD COLUMN IF NOT EXISTS impersonated boolean NOT NULL DEFAULT false;
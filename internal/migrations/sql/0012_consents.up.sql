@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS consent_versions (
+	id bigserial NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	effective_at timestamptz NOT NULL,
+	text text NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_consent_versions_effective_at ON consent_versions (effective_at);
+
+CREATE TABLE IF NOT EXISTS consents (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	version_id bigint NOT NULL,
+	accepted_at timestamptz NOT NULL DEFAULT now(),
+	ip text NOT NULL,
+	parent_name text,
+	withdrawn_at timestamptz,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_consents_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_consents_version FOREIGN KEY (version_id) REFERENCES consent_versions (id) ON UPDATE CASCADE ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS idx_consents_user_id ON consents (user_id);
+
+CREATE TABLE IF NOT EXISTS retention_requests (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	user_id uuid NOT NULL,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	due_at timestamptz NOT NULL,
+	completed_at timestamptz,
+	cancelled_at timestamptz,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_retention_requests_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_retention_requests_user_id ON retention_requests (user_id);
+CREATE INDEX IF NOT EXISTS idx_retention_requests_due_at ON retention_requests (due_at);
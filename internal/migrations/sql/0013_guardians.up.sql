@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS guardians (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	user_id uuid NOT NULL,
+	first_name text NOT NULL,
+	middle_name text NOT NULL,
+	last_name text,
+	relationship text NOT NULL,
+	tel text NOT NULL,
+	email text,
+	doc_type_id bigint NOT NULL,
+	doc_series text NOT NULL,
+	doc_number text NOT NULL,
+	doc_issuer text NOT NULL,
+	doc_issued_at date NOT NULL,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_guardians_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_guardians_doc_type FOREIGN KEY (doc_type_id) REFERENCES dict_id_doc_types (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_guardians_user_id ON guardians (user_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS archived_applications;
+
+ALTER TABLE applications DROP COLUMN IF EXISTS enrollment_order_id;
+
+DROP TABLE IF EXISTS enrollment_orders;
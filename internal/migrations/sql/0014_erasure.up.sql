@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS enrollment_orders (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	number text NOT NULL,
+	issued_at date NOT NULL,
+	PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_enrollment_orders_number ON enrollment_orders (number);
+
+ALTER TABLE applications ADD COLUMN IF NOT EXISTS enrollment_order_id uuid;
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_applications_enrollment_order') THEN
+		ALTER TABLE applications ADD CONSTRAINT fk_applications_enrollment_order
+			FOREIGN KEY (enrollment_order_id) REFERENCES enrollment_orders (id) ON UPDATE CASCADE ON DELETE RESTRICT;
+	END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS archived_applications (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	archived_at timestamptz NOT NULL DEFAULT now(),
+	applied_at timestamptz NOT NULL,
+	major_id uuid NOT NULL,
+	edu_level_id bigint NOT NULL,
+	status_id bigint NOT NULL,
+	priority smallint NOT NULL,
+	enrollment_order_id uuid,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_archived_applications_major_id ON archived_applications (major_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS export_jobs (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	created_at timestamptz NOT NULL DEFAULT now(),
+	user_id uuid NOT NULL,
+	completed_at timestamptz,
+	expires_at timestamptz NOT NULL,
+	failed boolean NOT NULL DEFAULT false,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_export_jobs_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs (user_id);
+CREATE INDEX IF NOT EXISTS idx_export_jobs_expires_at ON export_jobs (expires_at);
@@ -0,0 +1,11 @@
+-- pg_trgm is left installed, other database objects may depend on it
+DROP INDEX IF EXISTS
+	idx_users_email_trgm,
+	idx_users_user_name_trgm,
+	idx_user_details_first_name_trgm,
+	idx_user_details_middle_name_trgm,
+	idx_user_details_last_name_trgm,
+	idx_user_details_tel_trgm,
+	idx_user_details_snils_trgm,
+	idx_applications_user_major,
+	idx_users_created_at;
@@ -0,0 +1,13 @@
+-- trigram indexes keep substring search over users fast
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_user_name_trgm ON users USING gin (user_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_user_details_first_name_trgm ON user_details USING gin (first_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_user_details_middle_name_trgm ON user_details USING gin (middle_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_user_details_last_name_trgm ON user_details USING gin (last_name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_user_details_tel_trgm ON user_details USING gin (tel gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_user_details_snils_trgm ON user_details USING gin (snils gin_trgm_ops);
+
+-- filters by major and status and the default order of the list
+CREATE INDEX IF NOT EXISTS idx_applications_user_major ON applications (user_id, major_id, status_id);
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at, id);
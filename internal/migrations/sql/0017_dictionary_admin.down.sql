@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS dictionary_versions;
+
+ALTER TABLE college_majors DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE dict_genders DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE dict_town_types DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE dict_regions DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE dict_nationalities DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE dict_edu_levels DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE dict_id_doc_types DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE dict_edu_doc_types DROP COLUMN IF EXISTS retired_at;
+ALTER TABLE dict_app_statuses DROP COLUMN IF EXISTS retired_at;
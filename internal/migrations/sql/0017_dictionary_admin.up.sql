@@ -0,0 +1,16 @@
+ALTER TABLE dict_app_statuses ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE dict_edu_doc_types ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE dict_id_doc_types ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE dict_edu_levels ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE dict_nationalities ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE dict_regions ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE dict_town_types ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE dict_genders ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+ALTER TABLE college_majors ADD COLUMN IF NOT EXISTS retired_at timestamptz;
+
+CREATE TABLE IF NOT EXISTS dictionary_versions (
+	name text NOT NULL,
+	version bigint NOT NULL DEFAULT 0,
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	PRIMARY KEY (name)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS dict_translations;
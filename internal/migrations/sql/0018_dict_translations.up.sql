@@ -0,0 +1,7 @@
+CREATE TABLE dict_translations (
+	dictionary text NOT NULL,
+	entry_id text NOT NULL,
+	locale text NOT NULL,
+	display_value text NOT NULL,
+	PRIMARY KEY (dictionary, entry_id, locale)
+);
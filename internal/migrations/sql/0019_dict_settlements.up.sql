@@ -0,0 +1,13 @@
+CREATE TABLE dict_settlements (
+	code text NOT NULL,
+	region_id bigint NOT NULL,
+	town_type_id bigint,
+	name text NOT NULL,
+	post_code text,
+	PRIMARY KEY (code),
+	CONSTRAINT fk_dict_settlements_region FOREIGN KEY (region_id) REFERENCES dict_regions (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	CONSTRAINT fk_dict_settlements_town_type FOREIGN KEY (town_type_id) REFERENCES dict_town_types (id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+-- towns are looked up by the beginning of their name within a region
+CREATE INDEX idx_dict_settlements_region_name ON dict_settlements (region_id, lower(name) text_pattern_ops);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS major_entrance_tests;
+
+ALTER TABLE college_majors
+	ALTER COLUMN base DROP DEFAULT,
+	DROP COLUMN edu_level_id,
+	DROP COLUMN study_form,
+	DROP COLUMN duration_months,
+	DROP COLUMN qualification,
+	DROP COLUMN tuition_cost,
+	DROP COLUMN description;
@@ -0,0 +1,34 @@
+ALTER TABLE college_majors
+	ADD COLUMN edu_level_id bigint,
+	ADD COLUMN study_form text NOT NULL DEFAULT 'full-time',
+	ADD COLUMN duration_months bigint,
+	ADD COLUMN qualification text,
+	ADD COLUMN tuition_cost bigint,
+	ADD COLUMN description text NOT NULL DEFAULT '',
+	ADD CONSTRAINT fk_college_majors_edu_level FOREIGN KEY (edu_level_id) REFERENCES dict_edu_levels (id) ON UPDATE CASCADE ON DELETE RESTRICT,
+	ADD CONSTRAINT chk_college_majors_study_form CHECK (study_form IN ('full-time', 'part-time', 'distance'));
+
+CREATE INDEX idx_college_majors_edu_level_id ON college_majors (edu_level_id);
+
+-- bases were written as either the value or the display value of an
+-- education level, majors with anything else are left without a level
+UPDATE college_majors AS m
+SET edu_level_id = l.id
+FROM dict_edu_levels AS l
+WHERE lower(trim(m.base)) IN (lower(l.value), lower(l.display_value));
+
+-- base is superseded by edu_level_id, but it's kept for clients still
+-- reading it until the backfill above is verified; majors saved without
+-- it get the display value of their level
+ALTER TABLE college_majors ALTER COLUMN base SET DEFAULT '';
+
+CREATE TABLE major_entrance_tests (
+	id uuid NOT NULL DEFAULT gen_random_uuid(),
+	major_id uuid NOT NULL,
+	position bigint NOT NULL DEFAULT 0,
+	name text NOT NULL,
+	min_score bigint,
+	PRIMARY KEY (id),
+	CONSTRAINT fk_college_majors_entrance_tests FOREIGN KEY (major_id) REFERENCES college_majors (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_major_entrance_tests_major_id ON major_entrance_tests (major_id);
@@ -0,0 +1,8 @@
+DELETE FROM retention_requests WHERE user_id IS NULL;
+
+ALTER TABLE retention_requests
+	DROP COLUMN blocked_reason,
+	DROP COLUMN blocked_at,
+	DROP CONSTRAINT fk_retention_requests_user,
+	ADD CONSTRAINT fk_retention_requests_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+	ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,7 @@
+-- requests outlive the users they erase, so it's known the data was disposed of
+ALTER TABLE retention_requests
+	ALTER COLUMN user_id DROP NOT NULL,
+	DROP CONSTRAINT fk_retention_requests_user,
+	ADD CONSTRAINT fk_retention_requests_user FOREIGN KEY (user_id) REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL,
+	ADD COLUMN blocked_at timestamptz,
+	ADD COLUMN blocked_reason text;
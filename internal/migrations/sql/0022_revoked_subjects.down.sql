@@ -0,0 +1,3 @@
+DELETE FROM revoked_tokens WHERE issued_before IS NOT NULL;
+
+ALTER TABLE revoked_tokens DROP COLUMN issued_before;
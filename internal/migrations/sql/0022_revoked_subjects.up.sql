@@ -0,0 +1 @@
+ALTER TABLE revoked_tokens ADD COLUMN IF NOT EXISTS issued_before timestamptz;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS export_archives;
+
+DELETE FROM export_jobs WHERE completed_at IS NOT NULL AND NOT failed;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS export_archives (
+	job_id uuid NOT NULL,
+	data bytea NOT NULL,
+	PRIMARY KEY (job_id),
+	CONSTRAINT fk_export_archives_job FOREIGN KEY (job_id) REFERENCES export_jobs (id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+-- archives of jobs completed before are on the disk of whichever
+-- instance prepared them, the jobs are dropped so they get requested again
+DELETE FROM export_jobs WHERE completed_at IS NOT NULL AND NOT failed;
@@ -0,0 +1 @@
+ALTER TABLE retention_requests DROP COLUMN failures;
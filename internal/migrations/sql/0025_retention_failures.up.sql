@@ -0,0 +1 @@
+ALTER TABLE retention_requests ADD COLUMN IF NOT EXISTS failures integer NOT NULL DEFAULT 0;
@@ -2,45 +2,51 @@ package models
 
 import (
 	"imi/college/internal/types/date"
+	"imi/college/internal/types/jsonb"
 	"time"
 
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 )
 
-func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&User{},
-		&Password{},
-		&UserToken{},
-		&UserDetails{},
-		&UserAddress{},
-		&UserFile{},
-		&Application{},
-		&DictAppStatus{},
-		&DictEduDocType{},
-		&DictIdDocType{},
-		&DictEduLevel{},
-		&DictNationality{},
-		&DictRegion{},
-		&DictTownType{},
-		&DictGender{},
-		&CollegeMajor{},
-		&DocStatus{},
-		&IdentityDoc{},
-		&EducationDoc{},
-	)
+// version of the schema applied by internal/migrations
+type SchemaMigration struct {
+	Version   int64     `gorm:"not null;primaryKey;autoIncrement:false;"`
+	Name      string    `gorm:"not null;"`
+	AppliedAt time.Time `gorm:"not null;default:now();"`
 }
 
 type User struct {
 	ID          uuid.UUID    `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
 	CreatedAt   time.Time    `gorm:"not null;default:now();" json:"createdAt"`
 	UserName    string       `gorm:"not null;uniqueIndex;" json:"username"`
-	Email       string       `gorm:"not null;uniqueIndex;" json:"email"`
+	Email       string       `gorm:"not null;uniqueIndex:idx_users_email_lower,expression:lower(email);" json:"email"`
 	IsVerified  bool         `gorm:"not null;default:false;" json:"isVerified"`
 	Permissions int64        `gorm:"not null;default:0;" json:"permissions,string"`
 	Details     *UserDetails `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"details"`
 	Address     *UserAddress `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Roles       []Role       `gorm:"many2many:user_roles;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"roles"`
+}
+
+// permissions granted to the user directly combined with
+// permissions of every role assigned to them
+func (u User) EffectivePermissions() int64 {
+	effective := u.Permissions
+
+	for _, role := range u.Roles {
+		effective |= role.Permissions
+	}
+
+	return effective
+}
+
+type Role struct {
+	ID          uuid.UUID `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	CreatedAt   time.Time `gorm:"not null;default:now();" json:"createdAt"`
+	Name        string    `gorm:"not null;uniqueIndex;" json:"name"`
+	DisplayName string    `gorm:"not null;" json:"displayName"`
+	Permissions int64     `gorm:"not null;default:0;" json:"permissions,string"`
+	// built-in roles can be changed but not deleted
+	IsSystem bool `gorm:"not null;default:false;" json:"isSystem"`
 }
 
 type Password struct {
@@ -51,12 +57,64 @@ type Password struct {
 }
 
 type UserToken struct {
-	ID        uuid.UUID `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
-	User      User      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
-	UserID    uuid.UUID `gorm:"not null;" json:"userId"`
-	CreatedAt time.Time `gorm:"not null;default:now();" json:"createdAt"`
-	ExpiresAt time.Time `gorm:"not null;default:now() + interval '2 days';" json:"expiresAt"`
-	Token     string    `gorm:"not null;uniqueIndex;" json:"token"`
+	ID         uuid.UUID `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	User       User      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID     uuid.UUID `gorm:"not null;" json:"userId"`
+	CreatedAt  time.Time `gorm:"not null;default:now();" json:"createdAt"`
+	ExpiresAt  time.Time `gorm:"not null;default:now() + interval '2 days';" json:"expiresAt"`
+	LastUsedAt time.Time `gorm:"not null;default:now();" json:"lastUsedAt"`
+	Token      string    `gorm:"not null;uniqueIndex;" json:"token"`
+	// set when the token was issued to a staff member
+	// acting on behalf of the user
+	Impersonator   *User      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	ImpersonatorID *uuid.UUID `gorm:"type:uuid;" json:"impersonatorId,omitempty"`
+}
+
+// refresh tokens are single use, each rotation creates a new token
+// within the same family, so reuse of an already rotated token
+// can be detected and the whole family revoked
+type RefreshToken struct {
+	ID            uuid.UUID  `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	User          User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID        uuid.UUID  `gorm:"not null;type:uuid;" json:"userId"`
+	FamilyID      uuid.UUID  `gorm:"not null;type:uuid;index;" json:"familyId"`
+	AccessToken   *UserToken `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	AccessTokenID *uuid.UUID `gorm:"type:uuid;" json:"-"`
+	CreatedAt     time.Time  `gorm:"not null;default:now();" json:"createdAt"`
+	ExpiresAt     time.Time  `gorm:"not null;" json:"expiresAt"`
+	UsedAt        *time.Time `json:"-"`
+	RevokedAt     *time.Time `json:"-"`
+	Token         string     `gorm:"not null;uniqueIndex;" json:"token"`
+}
+
+// ids of signed tokens or whole refresh token families revoked before
+// expiration, kept only until the tokens would have expired anyway
+type RevokedToken struct {
+	ID        string    `gorm:"not null;primaryKey;" json:"id"`
+	ExpiresAt time.Time `gorm:"not null;index;" json:"expiresAt"`
+	// set when every token of the user with the ID issued
+	// up to the time is revoked, e.g. after a role change
+	IssuedBefore *time.Time `json:"issuedBefore"`
+}
+
+// second factor of the user, enrollment is finished once the user
+// proves their authenticator works by confirming it with a code
+type UserTOTP struct {
+	ID           uuid.UUID  `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	User         User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID       uuid.UUID  `gorm:"not null;uniqueIndex;type:uuid;" json:"userId"`
+	CreatedAt    time.Time  `gorm:"not null;default:now();" json:"createdAt"`
+	ConfirmedAt  *time.Time `json:"confirmedAt"`
+	Secret       string     `gorm:"not null;" json:"-"`
+	LastUsedStep int64      `gorm:"not null;default:0;" json:"-"`
+}
+
+type RecoveryCode struct {
+	ID     uuid.UUID  `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	User   User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID uuid.UUID  `gorm:"not null;index;type:uuid;" json:"userId"`
+	Hash   string     `gorm:"not null;" json:"-"`
+	UsedAt *time.Time `json:"usedAt"`
 }
 
 type UserDetails struct {
@@ -107,68 +165,142 @@ type Application struct {
 	StatusID   int           `gorm:"not null;" json:"statusId"`
 	Status     DictAppStatus `gorm:"not null;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"status,omitempty"`
 	Priority   uint8         `gorm:"not null;default:1;" json:"priority"`
+	// set once the applicant is enrolled, enrolled applicants' data is kept
+	EnrollmentOrderID *uuid.UUID       `gorm:"type:uuid;" json:"enrollmentOrderId"`
+	EnrollmentOrder   *EnrollmentOrder `gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"-"`
+}
+
+// order by which applicants are enrolled into the college
+type EnrollmentOrder struct {
+	ID        uuid.UUID `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	CreatedAt time.Time `gorm:"not null;default:now();" json:"createdAt"`
+	Number    string    `gorm:"not null;uniqueIndex;" json:"number"`
+	IssuedAt  date.Date `gorm:"not null;type:date;" json:"issuedAt"`
+}
+
+// application of an erased user stripped of anything
+// identifying them, kept for admission statistics
+type ArchivedApplication struct {
+	ID                uuid.UUID  `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	ArchivedAt        time.Time  `gorm:"not null;default:now();" json:"archivedAt"`
+	AppliedAt         time.Time  `gorm:"not null;" json:"appliedAt"`
+	MajorID           uuid.UUID  `gorm:"not null;type:uuid;index;" json:"majorId"`
+	EduLevelID        int        `gorm:"not null;" json:"eduLevelId"`
+	StatusID          int        `gorm:"not null;" json:"statusId"`
+	Priority          uint8      `gorm:"not null;" json:"priority"`
+	EnrollmentOrderID *uuid.UUID `gorm:"type:uuid;" json:"enrollmentOrderId"`
 }
 
 type DictAppStatus struct {
-	ID           int     `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
-	IsDefault    bool    `gorm:"not null;default:false;" json:"isDefault"`
-	Value        string  `gorm:"not null;" json:"value"`
-	DisplayValue *string `json:"displayValue"`
+	ID           int        `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
+	IsDefault    bool       `gorm:"not null;default:false;" json:"isDefault"`
+	Value        string     `gorm:"not null;" json:"value"`
+	DisplayValue *string    `json:"displayValue"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
 }
 
 type DictEduDocType struct {
-	ID           int     `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
-	Value        string  `gorm:"not null;" json:"value"`
-	DisplayValue *string `json:"displayValue"`
+	ID           int        `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
+	Value        string     `gorm:"not null;" json:"value"`
+	DisplayValue *string    `json:"displayValue"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
 }
 
 type DictIdDocType struct {
-	ID           int     `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
-	Value        string  `gorm:"not null;" json:"value"`
-	DisplayValue *string `json:"displayValue"`
+	ID           int        `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
+	Value        string     `gorm:"not null;" json:"value"`
+	DisplayValue *string    `json:"displayValue"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
 }
 
 type DictEduLevel struct {
-	ID           int     `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
-	Value        string  `gorm:"not null;" json:"value"`
-	DisplayValue *string `json:"displayValue"`
+	ID           int        `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
+	Value        string     `gorm:"not null;" json:"value"`
+	DisplayValue *string    `json:"displayValue"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
 }
 
 type DictNationality struct {
-	ID           int     `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
-	Value        string  `gorm:"not null;" json:"value"`
-	DisplayValue *string `json:"displayValue"`
-	SortPriority int     `gorm:"not null;default:0;" json:"sortPriority"`
+	ID           int        `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
+	Value        string     `gorm:"not null;" json:"value"`
+	DisplayValue *string    `json:"displayValue"`
+	SortPriority int        `gorm:"not null;default:0;" json:"sortPriority"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
 }
 
 type DictRegion struct {
-	ID           int     `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
-	RegionID     int     `gorm:"not null;uniqueIndex;" json:"regionId"`
-	Value        string  `gorm:"not null;" json:"value"`
-	DisplayValue *string `json:"displayValue"`
-	SortPriority int     `gorm:"not null;default:0;" json:"sortPriority"`
+	ID           int        `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
+	RegionID     int        `gorm:"not null;uniqueIndex;" json:"regionId"`
+	Value        string     `gorm:"not null;" json:"value"`
+	DisplayValue *string    `json:"displayValue"`
+	SortPriority int        `gorm:"not null;default:0;" json:"sortPriority"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
 }
 
 type DictTownType struct {
-	ID           int     `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
-	Value        string  `gorm:"not null;" json:"value"`
-	DisplayValue *string `json:"displayValue"`
+	ID           int        `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
+	Value        string     `gorm:"not null;" json:"value"`
+	DisplayValue *string    `json:"displayValue"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
 }
 
 type DictGender struct {
-	ID           int     `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
-	Value        string  `gorm:"not null;" json:"value"`
-	DisplayValue *string `json:"displayValue"`
+	ID           int        `gorm:"not null;primaryKey;autoIncrement:false;" json:"id"`
+	Value        string     `gorm:"not null;" json:"value"`
+	DisplayValue *string    `json:"displayValue"`
+	RetiredAt    *time.Time `json:"retiredAt,omitempty"`
 }
 
+// forms of study majors are offered in
+const (
+	StudyFormFullTime = "full-time"
+	StudyFormPartTime = "part-time"
+	StudyFormDistance = "distance"
+)
+
+var StudyForms = []string{StudyFormFullTime, StudyFormPartTime, StudyFormDistance}
+
 type CollegeMajor struct {
-	ID           uuid.UUID `gorm:"not null;type:uuid;default:gen_random_uuid();" json:"id"`
-	Name         string    `gorm:"not null;" json:"name"`
-	Prefix       string    `gorm:"not null;" json:"prefix"`
-	Base         string    `gorm:"not null;" json:"base"`
-	NameOfficial string    `gorm:"not null;" json:"nameOfficial"`
-	Budget       bool      `gorm:"not null;default:false;" json:"budget"` // TODO: there might be a better name for this field
-	Code         string    `gorm:"not null;" json:"code"`
+	ID     uuid.UUID `gorm:"not null;type:uuid;default:gen_random_uuid();" json:"id"`
+	Name   string    `gorm:"not null;" json:"name"`
+	Prefix string    `gorm:"not null;" json:"prefix"`
+	// Deprecated: use EduLevel, kept for clients which still read it
+	Base         string `gorm:"not null;default:'';" json:"base"`
+	NameOfficial string `gorm:"not null;" json:"nameOfficial"`
+	Budget       bool   `gorm:"not null;default:false;" json:"budget"` // TODO: there might be a better name for this field
+	Code         string `gorm:"not null;" json:"code"`
+	// education level applicants must have, majors created before
+	// levels were referenced might not have one
+	EduLevelID *int          `gorm:"index;" json:"eduLevelId"`
+	EduLevel   *DictEduLevel `gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"eduLevel,omitempty"`
+	StudyForm  string        `gorm:"not null;default:full-time;check:study_form IN ('full-time', 'part-time', 'distance');" json:"studyForm"`
+	// e.g. 34 for 2 years and 10 months
+	DurationMonths *int    `json:"durationMonths"`
+	Qualification  *string `json:"qualification"`
+	// rubles per year of paid places, nil when there are none
+	TuitionCost   *int64              `json:"tuitionCost"`
+	Description   string              `gorm:"not null;default:'';" json:"description"`
+	EntranceTests []MajorEntranceTest `gorm:"foreignKey:MajorID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"entranceTests,omitempty"`
+	RetiredAt     *time.Time          `json:"retiredAt,omitempty"`
+}
+
+type MajorEntranceTest struct {
+	ID      uuid.UUID `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"-"`
+	MajorID uuid.UUID `gorm:"not null;type:uuid;index;" json:"-"`
+	// tests are listed in the order applicants take them
+	Position int    `gorm:"not null;default:0;" json:"-"`
+	Name     string `gorm:"not null;" json:"name"`
+	// nil when passing the test is enough
+	MinScore *int `json:"minScore"`
+}
+
+// majors a staff member is limited to, staff without any scopes
+// have access to applicants of every major
+type StaffScope struct {
+	UserID  uuid.UUID    `gorm:"not null;primaryKey;type:uuid;" json:"userId"`
+	User    User         `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	MajorID uuid.UUID    `gorm:"not null;primaryKey;type:uuid;" json:"majorId"`
+	Major   CollegeMajor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
 
 type DocStatus struct {
@@ -213,3 +345,153 @@ type EducationDoc struct {
 	IssuerRegionID int            `gorm:"not null;" json:"issuerRegionId"`
 	IssuerRegion   DictRegion     `gorm:"not null;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
 }
+
+// record of a user accessing another user's data; the table is append-only,
+// so there are no foreign keys which could cascade into deleting entries
+type AuditEntry struct {
+	ID        uuid.UUID `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	CreatedAt time.Time `gorm:"not null;default:now();index;" json:"createdAt"`
+	ActorID   uuid.UUID `gorm:"not null;type:uuid;index;" json:"actorId"`
+	TargetID  uuid.UUID `gorm:"not null;type:uuid;index;" json:"targetId"`
+	Action    string    `gorm:"not null;" json:"action"`
+	Resource  string    `gorm:"not null;" json:"resource"`
+	Method    string    `gorm:"not null;" json:"method"`
+	Path      string    `gorm:"not null;" json:"path"`
+	IP        string    `gorm:"not null;" json:"ip"`
+	// actor made the request using a token impersonating the target
+	Impersonated bool `gorm:"not null;default:false;" json:"impersonated"`
+}
+
+// before and after values of the columns changed in a user's entity,
+// the owner is not a foreign key, so history outlives deleted entities
+type ChangeRecord struct {
+	ID        uuid.UUID  `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	CreatedAt time.Time  `gorm:"not null;default:now();" json:"createdAt"`
+	ActorID   *uuid.UUID `gorm:"type:uuid;" json:"actorId"`
+	OwnerID   uuid.UUID  `gorm:"not null;type:uuid;index;" json:"ownerId"`
+	Entity    string     `gorm:"not null;index:idx_change_records_entity,priority:1;" json:"entity"`
+	EntityID  uuid.UUID  `gorm:"not null;type:uuid;index:idx_change_records_entity,priority:2;" json:"entityId"`
+	Operation string     `gorm:"not null;" json:"operation"`
+	Changes   jsonb.JSON `gorm:"not null;" json:"changes"`
+}
+
+// terms applicants consent to, the version in effect is the
+// latest one whose effective date has already come
+type ConsentVersion struct {
+	ID          int       `gorm:"not null;primaryKey;" json:"id"`
+	CreatedAt   time.Time `gorm:"not null;default:now();" json:"createdAt"`
+	EffectiveAt time.Time `gorm:"not null;index;" json:"effectiveAt"`
+	Text        string    `gorm:"not null;" json:"text"`
+}
+
+// consent of a user to processing of their personal data
+type Consent struct {
+	ID         uuid.UUID      `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	User       User           `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID     uuid.UUID      `gorm:"not null;type:uuid;index;" json:"userId"`
+	Version    ConsentVersion `gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"-"`
+	VersionID  int            `gorm:"not null;" json:"versionId"`
+	AcceptedAt time.Time      `gorm:"not null;default:now();" json:"acceptedAt"`
+	IP         string         `gorm:"not null;" json:"ip"`
+	// full name of the parent consenting on behalf of a minor
+	ParentName  *string    `json:"parentName"`
+	WithdrawnAt *time.Time `json:"withdrawnAt"`
+}
+
+// personal data of a user who has withdrawn their
+// consent has to be disposed of by the due date
+type RetentionRequest struct {
+	ID   uuid.UUID `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	User *User     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	// nil once the user is erased
+	UserID      *uuid.UUID `gorm:"type:uuid;index;" json:"userId"`
+	CreatedAt   time.Time  `gorm:"not null;default:now();" json:"createdAt"`
+	DueAt       time.Time  `gorm:"not null;index;" json:"dueAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	// consent was given again before the data was disposed of
+	CancelledAt *time.Time `json:"cancelledAt"`
+	// the user couldn't be erased and the staff has to decide on them,
+	// e.g. they are enrolled; blocked requests aren't retried
+	BlockedAt     *time.Time `json:"blockedAt"`
+	BlockedReason *string    `json:"blockedReason"`
+	// unexpected errors erasing the user, the request is blocked
+	// once there have been too many of them
+	Failures int `gorm:"not null;default:0;" json:"failures"`
+}
+
+// relationships of a guardian to the applicant
+const (
+	GuardianMother         = "mother"
+	GuardianFather         = "father"
+	GuardianAdoptiveParent = "adoptive-parent"
+	GuardianTutor          = "tutor"
+	GuardianTrustee        = "trustee"
+)
+
+// parent or legal guardian of a minor applicant
+type Guardian struct {
+	ID           uuid.UUID     `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	CreatedAt    time.Time     `gorm:"not null;default:now();" json:"createdAt"`
+	UserID       uuid.UUID     `gorm:"not null;type:uuid;index;" json:"userId"`
+	User         User          `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	FirstName    string        `gorm:"not null;" json:"firstName"`
+	MiddleName   string        `gorm:"not null;" json:"middleName"`
+	LastName     *string       `json:"lastName"`
+	Relationship string        `gorm:"not null;" json:"relationship"`
+	Tel          string        `gorm:"not null;" json:"tel"`
+	Email        *string       `json:"email"`
+	DocTypeID    int           `gorm:"not null;" json:"docTypeId"`
+	DocType      DictIdDocType `gorm:"not null;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	DocSeries    string        `gorm:"not null;" json:"docSeries"`
+	DocNumber    string        `gorm:"not null;" json:"docNumber"`
+	DocIssuer    string        `gorm:"not null;" json:"docIssuer"`
+	DocIssuedAt  date.Date     `gorm:"not null;type:date;" json:"docIssuedAt"`
+}
+
+// personal data export of a user prepared in the background
+type ExportJob struct {
+	ID          uuid.UUID  `gorm:"not null;primaryKey;type:uuid;default:gen_random_uuid();" json:"id"`
+	CreatedAt   time.Time  `gorm:"not null;default:now();" json:"createdAt"`
+	UserID      uuid.UUID  `gorm:"not null;type:uuid;index;" json:"userId"`
+	User        User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   time.Time  `gorm:"not null;index;" json:"expiresAt"`
+	Failed      bool       `gorm:"not null;default:false;" json:"failed"`
+}
+
+// prepared archive of the export job, it's kept in the database, so any
+// instance can serve it, and apart from the job, so jobs load quickly
+type ExportArchive struct {
+	JobID uuid.UUID `gorm:"not null;primaryKey;type:uuid;" json:"jobId"`
+	Job   ExportJob `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Data  []byte    `gorm:"not null;" json:"-"`
+}
+
+// incremented on every change of the dictionary,
+// so clients can tell whether their copy is stale
+type DictionaryVersion struct {
+	Name      string    `gorm:"not null;primaryKey;"`
+	Version   int64     `gorm:"not null;default:0;"`
+	UpdatedAt time.Time `gorm:"not null;default:now();"`
+}
+
+// display value of a dictionary entry in another locale,
+// translations of majors replace their names
+type DictTranslation struct {
+	Dictionary   string `gorm:"not null;primaryKey;" json:"dictionary"`
+	EntryID      string `gorm:"not null;primaryKey;" json:"entryId"`
+	Locale       string `gorm:"not null;primaryKey;" json:"locale"`
+	DisplayValue string `gorm:"not null;" json:"displayValue"`
+}
+
+// town or rural settlement of a region, imported from KLADR or FIAS dumps
+type DictSettlement struct {
+	// KLADR code or FIAS guid of the settlement
+	Code       string        `gorm:"not null;primaryKey;" json:"code"`
+	RegionID   int           `gorm:"not null;" json:"regionId"`
+	Region     DictRegion    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	TownTypeID *int          `json:"townTypeId"`
+	TownType   *DictTownType `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	Name       string        `gorm:"not null;" json:"name"`
+	PostCode   *string       `json:"postCode"`
+}
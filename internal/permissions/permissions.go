@@ -10,6 +10,19 @@ const (
 
 	// full access, absolute power
 	PermissionAdmin int64 = 1 << 3
+
+	// allows to view applications of any user
+	PermissionViewApplications int64 = 1 << 4
+	// allows to submit, change and withdraw applications of any user
+	PermissionEditApplications int64 = 1 << 5
+	// allows to view identity and education documents of any user
+	PermissionViewDocuments int64 = 1 << 6
+	// allows to add and verify documents of any user
+	PermissionEditDocuments int64 = 1 << 7
+	// allows to manage dictionaries
+	PermissionEditDictionaries int64 = 1 << 8
+	// allows to manage college majors
+	PermissionEditMajors int64 = 1 << 9
 )
 
 func HasPermissions(target int64, required int64) bool {
@@ -36,18 +49,112 @@ func HasAdmin(target int64) bool {
 	return HasPermissions(target, PermissionAdmin)
 }
 
+// users holding any permission bit can access other users' data
+func IsElevated(target int64) bool {
+	return target != 0
+}
+
 type PermissionTable struct {
-	ViewUser   bool `json:"viewUser"`
-	EditUser   bool `json:"editUser"`
-	DeleteUser bool `json:"deleteUser"`
-	Admin      bool `json:"admin"`
+	ViewUser         bool `json:"viewUser"`
+	EditUser         bool `json:"editUser"`
+	DeleteUser       bool `json:"deleteUser"`
+	Admin            bool `json:"admin"`
+	ViewApplications bool `json:"viewApplications"`
+	EditApplications bool `json:"editApplications"`
+	ViewDocuments    bool `json:"viewDocuments"`
+	EditDocuments    bool `json:"editDocuments"`
+	EditDictionaries bool `json:"editDictionaries"`
+	EditMajors       bool `json:"editMajors"`
 }
 
 func NewPermissionTable(permissions int64) PermissionTable {
 	return PermissionTable{
-		ViewUser:   HasPermissions(permissions, PermissionViewUser),
-		EditUser:   HasPermissions(permissions, PermissionEditUser),
-		DeleteUser: HasPermissions(permissions, PermissionDeleteUser),
-		Admin:      HasPermissions(permissions, PermissionAdmin),
+		ViewUser:         HasPermissions(permissions, PermissionViewUser),
+		EditUser:         HasPermissions(permissions, PermissionEditUser),
+		DeleteUser:       HasPermissions(permissions, PermissionDeleteUser),
+		Admin:            HasPermissions(permissions, PermissionAdmin),
+		ViewApplications: HasPermissions(permissions, PermissionViewApplications),
+		EditApplications: HasPermissions(permissions, PermissionEditApplications),
+		ViewDocuments:    HasPermissions(permissions, PermissionViewDocuments),
+		EditDocuments:    HasPermissions(permissions, PermissionEditDocuments),
+		EditDictionaries: HasPermissions(permissions, PermissionEditDictionaries),
+		EditMajors:       HasPermissions(permissions, PermissionEditMajors),
+	}
+}
+
+// converts the table back to permission bits
+func (t PermissionTable) Bits() int64 {
+	var bits int64
+
+	flags := map[int64]bool{
+		PermissionViewUser:         t.ViewUser,
+		PermissionEditUser:         t.EditUser,
+		PermissionDeleteUser:       t.DeleteUser,
+		PermissionAdmin:            t.Admin,
+		PermissionViewApplications: t.ViewApplications,
+		PermissionEditApplications: t.EditApplications,
+		PermissionViewDocuments:    t.ViewDocuments,
+		PermissionEditDocuments:    t.EditDocuments,
+		PermissionEditDictionaries: t.EditDictionaries,
+		PermissionEditMajors:       t.EditMajors,
+	}
+
+	for bit, set := range flags {
+		if set {
+			bits |= bit
+		}
 	}
+
+	return bits
+}
+
+const (
+	RoleApplicant = "applicant"
+	// enters applicants' data at the front desk
+	RoleOperator = "operator"
+	// checks submitted documents
+	RoleReviewer = "reviewer"
+	// manages applications, majors and dictionaries
+	RoleSecretary = "committee-secretary"
+	RoleAdmin     = "admin"
+)
+
+type RoleTemplate struct {
+	Name        string
+	DisplayName string
+	Permissions int64
+}
+
+// roles every installation starts with, their permission
+// sets can be changed later by admins
+var DefaultRoles = []RoleTemplate{
+	{
+		Name:        RoleApplicant,
+		DisplayName: "Абитуриент",
+		Permissions: 0,
+	},
+	{
+		Name:        RoleOperator,
+		DisplayName: "Оператор",
+		Permissions: PermissionViewUser | PermissionEditUser |
+			PermissionViewApplications | PermissionEditApplications |
+			PermissionViewDocuments | PermissionEditDocuments,
+	},
+	{
+		Name:        RoleReviewer,
+		DisplayName: "Проверяющий",
+		Permissions: PermissionViewUser | PermissionViewApplications |
+			PermissionViewDocuments | PermissionEditDocuments,
+	},
+	{
+		Name:        RoleSecretary,
+		DisplayName: "Ответственный секретарь",
+		Permissions: PermissionViewUser | PermissionViewApplications | PermissionEditApplications |
+			PermissionViewDocuments | PermissionEditDictionaries | PermissionEditMajors,
+	},
+	{
+		Name:        RoleAdmin,
+		DisplayName: "Администратор",
+		Permissions: PermissionAdmin,
+	},
 }
@@ -0,0 +1,103 @@
+package query
+
+import (
+	"imi/college/internal/cache"
+	"imi/college/internal/models"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// users and tokens are looked up on every authenticated request, writes
+// invalidate the entries, the short TTL bounds staleness left by writes
+// racing with lookups or made by other instances
+const sessionCacheTTL = 30 * time.Second
+
+var (
+	userCache  = cache.NewMemory[uuid.UUID, models.User](10_000, sessionCacheTTL)
+	tokenCache = cache.NewMemory[string, models.UserToken](10_000, sessionCacheTTL)
+)
+
+func init() {
+	cache.Publish("users", userCache)
+	cache.Publish("tokens", tokenCache)
+}
+
+// copies slices and pointers, so callers modifying the user
+// don't change the cached one
+func cloneUser(user models.User) models.User {
+	user.Roles = slices.Clone(user.Roles)
+
+	if user.Details != nil {
+		details := *user.Details
+		user.Details = &details
+	}
+
+	if user.Address != nil {
+		address := *user.Address
+		user.Address = &address
+	}
+
+	return user
+}
+
+// same as GetUserByID, but served from the cache when possible
+func GetCachedUserByID(db *gorm.DB, id uuid.UUID) (models.User, error) {
+	if user, ok := userCache.Get(id); ok {
+		return cloneUser(user), nil
+	}
+
+	user, err := GetUserByID(db, id)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	userCache.Set(id, cloneUser(user))
+
+	return user, nil
+}
+
+// must be called after the transaction changing the user, its
+// details or roles has been committed
+func InvalidateUser(id uuid.UUID) {
+	userCache.Delete(id)
+}
+
+// drops every cached user, used when a change affects many
+// users at once, e.g. permissions of a role
+func InvalidateUsers() {
+	userCache.Clear()
+}
+
+// same as GetTokenByValue, but served from the cache when possible
+func GetCachedTokenByValue(db *gorm.DB, value string) (models.UserToken, error) {
+	if token, ok := tokenCache.Get(value); ok {
+		return token, nil
+	}
+
+	token, err := GetTokenByValue(db, value)
+	if err != nil {
+		return models.UserToken{}, err
+	}
+
+	tokenCache.Set(value, token)
+
+	return token, nil
+}
+
+// stores the token after its expiration has been extended
+func CacheToken(token models.UserToken) {
+	tokenCache.Set(token.Token, token)
+}
+
+func InvalidateToken(value string) {
+	tokenCache.Delete(value)
+}
+
+// drops every cached token, used when tokens are deleted
+// without knowing their values, e.g. a revoked family
+func InvalidateTokens() {
+	tokenCache.Clear()
+}
@@ -0,0 +1,347 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// list query parameter with an invalid value
+type ListParamError struct {
+	Param  string
+	Reason string
+}
+
+func (e ListParamError) Error() string {
+	return fmt.Sprintf("%s %s", e.Param, e.Reason)
+}
+
+type SortField struct {
+	// column or expression the results are ordered by
+	Column string
+	// path to the struct field holding the value, e.g. "Details.FirstName"
+	Field string
+	// the value may be missing, e.g. when it comes from a LEFT JOIN;
+	// such items go last in ascending order and first in descending
+	Nullable bool
+}
+
+type Filter struct {
+	// column or expression the value is compared with
+	Column string
+	// comparison operator, equality if empty
+	Operator string
+	// converts the raw value, returned errors describe what's expected
+	Parse func(raw string) (any, error)
+}
+
+// what a list endpoint allows clients to request
+type ListSpec struct {
+	// sort fields keyed by their names in requests
+	Sort map[string]SortField
+	// name of the sort field, prefixed with "-" for descending order
+	DefaultSort string
+	// unique field breaking ties between equal sort values
+	Key SortField
+	// filters keyed by names of query parameters
+	Filters      map[string]Filter
+	DefaultLimit int
+	MaxLimit     int
+}
+
+type condition struct {
+	sql   string
+	value any
+}
+
+// list parameters parsed from a request
+type List struct {
+	Limit      int
+	SortName   string
+	Descending bool
+
+	sort  SortField
+	key   SortField
+	after []string
+	// sort value of the last item of the previous page is missing
+	afterNull  bool
+	conditions []condition
+}
+
+func ParseString(raw string) (any, error) {
+	return raw, nil
+}
+
+func ParseInt(raw string) (any, error) {
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be a number")
+	}
+	return value, nil
+}
+
+func ParseBool(raw string) (any, error) {
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be either true or false")
+	}
+	return value, nil
+}
+
+func ParseUUID(raw string) (any, error) {
+	value, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be a valid uuid")
+	}
+	return value, nil
+}
+
+func ParseTime(raw string) (any, error) {
+	value, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("must be an RFC 3339 timestamp")
+	}
+	return value, nil
+}
+
+// accepts only one of the listed values
+func ParseOneOf(allowed ...string) func(raw string) (any, error) {
+	return func(raw string) (any, error) {
+		for _, value := range allowed {
+			if raw == value {
+				return raw, nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+// cursor holds the sort field name along with values of the sort
+// and key fields of the last item of the previous page, missing
+// sort values are kept as null
+func encodeCursor(sortParam string, sortValue *string, keyValue string) (string, error) {
+	raw, err := json.Marshal([]*string{&sortParam, sortValue, &keyValue})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(cursor string) (string, []*string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var values []*string
+
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return "", nil, err
+	}
+
+	if len(values) != 3 || values[0] == nil || values[2] == nil {
+		return "", nil, fmt.Errorf("cursor is malformed")
+	}
+
+	return *values[0], values[1:], nil
+}
+
+func ParseList(params url.Values, spec ListSpec) (List, error) {
+	list := List{Limit: spec.DefaultLimit, key: spec.Key}
+
+	sortParam := params.Get("sort")
+	if len(sortParam) == 0 {
+		sortParam = spec.DefaultSort
+	}
+
+	list.Descending = strings.HasPrefix(sortParam, "-")
+	list.SortName = strings.TrimPrefix(sortParam, "-")
+
+	field, ok := spec.Sort[list.SortName]
+	if !ok {
+		names := make([]string, 0, len(spec.Sort))
+		for name := range spec.Sort {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return List{}, ListParamError{"sort", "must be one of " + strings.Join(names, ", ")}
+	}
+	list.sort = field
+
+	if value := params.Get("limit"); len(value) > 0 {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > spec.MaxLimit {
+			return List{}, ListParamError{"limit", fmt.Sprintf("must be a number between 1 and %d", spec.MaxLimit)}
+		}
+		list.Limit = limit
+	}
+
+	if value := params.Get("cursor"); len(value) > 0 {
+		cursorSort, after, err := decodeCursor(value)
+		if err != nil || cursorSort != sortParam || (after[0] == nil && !field.Nullable) {
+			return List{}, ListParamError{"cursor", "is invalid"}
+		}
+
+		list.afterNull = after[0] == nil
+		list.after = []string{"", *after[1]}
+		if !list.afterNull {
+			list.after[0] = *after[0]
+		}
+	}
+
+	for name, filter := range spec.Filters {
+		raw := params.Get(name)
+		if len(raw) == 0 {
+			continue
+		}
+
+		value, err := filter.Parse(raw)
+		if err != nil {
+			return List{}, ListParamError{name, err.Error()}
+		}
+
+		operator := filter.Operator
+		if len(operator) == 0 {
+			operator = "="
+		}
+
+		list.conditions = append(list.conditions, condition{filter.Column + " " + operator + " ?", value})
+	}
+
+	return list, nil
+}
+
+// GORM scope applying filters, order and the page bounds; one
+// extra item is requested to tell whether there is a next page
+func (l List) Scope(db *gorm.DB) *gorm.DB {
+	for _, c := range l.conditions {
+		db = db.Where(c.sql, c.value)
+	}
+
+	direction, comparison, nulls := "ASC", ">", " NULLS LAST"
+	if l.Descending {
+		direction, comparison, nulls = "DESC", "<", " NULLS FIRST"
+	}
+
+	if !l.sort.Nullable {
+		nulls = ""
+	}
+
+	if len(l.after) > 0 {
+		db = db.Where(l.afterCondition(comparison))
+	}
+
+	return db.
+		Order(l.sort.Column + " " + direction + nulls).
+		Order(l.key.Column + " " + direction).
+		Limit(l.Limit + 1)
+}
+
+// items following the last item of the previous page; comparisons with
+// null are never true, so missing values are matched separately
+func (l List) afterCondition(comparison string) clause.Expression {
+	sort, key := l.sort.Column, l.key.Column
+
+	switch {
+	case l.afterNull && l.Descending:
+		return gorm.Expr(sort+" IS NOT NULL OR "+key+" "+comparison+" ?", l.after[1])
+	case l.afterNull:
+		return gorm.Expr(sort+" IS NULL AND "+key+" "+comparison+" ?", l.after[1])
+	case l.sort.Nullable && !l.Descending:
+		return gorm.Expr("("+sort+", "+key+") "+comparison+" (?, ?) OR "+sort+" IS NULL", l.after[0], l.after[1])
+	default:
+		return gorm.Expr("("+sort+", "+key+") "+comparison+" (?, ?)", l.after[0], l.after[1])
+	}
+}
+
+// cursor values are passed to the database as text, nil is
+// returned if the value or any struct on the path to it is nil
+func cursorValue(item reflect.Value, path string) (*string, error) {
+	value := item
+
+	for _, name := range strings.Split(path, ".") {
+		value = reflect.Indirect(value)
+		if !value.IsValid() {
+			return nil, nil
+		}
+
+		value = value.FieldByName(name)
+		if !value.IsValid() {
+			return nil, fmt.Errorf("%s is not a field", path)
+		}
+	}
+
+	value = reflect.Indirect(value)
+	if !value.IsValid() {
+		return nil, nil
+	}
+
+	var text string
+
+	switch v := value.Interface().(type) {
+	case time.Time:
+		text = v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		text = v.String()
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	return &text, nil
+}
+
+// trims the extra item fetched by the scope and
+// returns the cursor of the next page if there is one
+func Paginate[T any](list List, items []T) ([]T, *string, error) {
+	if items == nil {
+		items = []T{}
+	}
+
+	if len(items) <= list.Limit {
+		return items, nil, nil
+	}
+
+	items = items[:list.Limit]
+	last := reflect.ValueOf(items[list.Limit-1])
+
+	sortValue, err := cursorValue(last, list.sort.Field)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if sortValue == nil && !list.sort.Nullable {
+		return nil, nil, fmt.Errorf("%s is nil", list.sort.Field)
+	}
+
+	keyValue, err := cursorValue(last, list.key.Field)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if keyValue == nil {
+		return nil, nil, fmt.Errorf("%s is nil", list.key.Field)
+	}
+
+	sortParam := list.SortName
+	if list.Descending {
+		sortParam = "-" + sortParam
+	}
+
+	cursor, err := encodeCursor(sortParam, sortValue, *keyValue)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return items, &cursor, nil
+}
@@ -0,0 +1,225 @@
+package query
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type listItem struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Details   *struct{ Name string }
+}
+
+var testListSpec = ListSpec{
+	Sort: map[string]SortField{
+		"createdAt": {Column: "created_at", Field: "CreatedAt"},
+		"name":      {Column: "name", Field: "Details.Name"},
+		"nickname":  {Column: "nickname", Field: "Details.Name", Nullable: true},
+	},
+	DefaultSort: "-createdAt",
+	Key:         SortField{Column: "id", Field: "ID"},
+	Filters: map[string]Filter{
+		"verified": {Column: "verified", Parse: ParseBool},
+	},
+	DefaultLimit: 2,
+	MaxLimit:     10,
+}
+
+func TestParseListDefaults(t *testing.T) {
+	list, err := ParseList(url.Values{}, testListSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list.Limit != 2 || list.SortName != "createdAt" || !list.Descending {
+		t.Fatalf("defaults must be applied, got %+v", list)
+	}
+}
+
+func TestParseListRejectsInvalidParams(t *testing.T) {
+	cases := []url.Values{
+		{"sort": {"unknown"}},
+		{"limit": {"0"}},
+		{"limit": {"11"}},
+		{"verified": {"maybe"}},
+		{"cursor": {"not a cursor"}},
+	}
+
+	for _, params := range cases {
+		_, err := ParseList(params, testListSpec)
+		if _, ok := err.(ListParamError); !ok {
+			t.Fatalf("%v must be rejected with ListParamError, got %v", params, err)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	list, err := ParseList(url.Values{}, testListSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	items := []listItem{
+		{ID: uuid.New(), CreatedAt: now},
+		{ID: uuid.New(), CreatedAt: now.Add(-time.Minute)},
+		{ID: uuid.New(), CreatedAt: now.Add(-2 * time.Minute)},
+	}
+
+	page, cursor, err := Paginate(list, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 2 || cursor == nil {
+		t.Fatalf("extra item must be trimmed and a cursor returned, got %d items", len(page))
+	}
+
+	next, err := ParseList(url.Values{"cursor": {*cursor}}, testListSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(next.after) != 2 || next.after[1] != items[1].ID.String() {
+		t.Fatalf("cursor must point at the last item of the page, got %v", next.after)
+	}
+
+	// cursors can't be reused with a different order
+	if _, err := ParseList(url.Values{"cursor": {*cursor}, "sort": {"createdAt"}}, testListSpec); err == nil {
+		t.Fatal("cursor of another order must be rejected")
+	}
+
+	page, cursor, err = Paginate(list, items[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 1 || cursor != nil {
+		t.Fatal("last page must not have a cursor")
+	}
+}
+
+func TestPaginateNilField(t *testing.T) {
+	list, err := ParseList(url.Values{"sort": {"name"}}, testListSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []listItem{{ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}}
+
+	if _, _, err := Paginate(list, items); err == nil {
+		t.Fatal("sorting by a field behind a nil pointer must fail")
+	}
+}
+
+// statements are only built, nothing is sent to the database
+func newDryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func buildSQL(db *gorm.DB, scopes ...func(*gorm.DB) *gorm.DB) string {
+	var items []map[string]any
+
+	stmt := db.Table("items").Scopes(scopes...).Find(&items).Statement
+
+	return db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+}
+
+func TestPaginateNullableField(t *testing.T) {
+	list, err := ParseList(url.Values{"sort": {"nickname"}}, testListSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []listItem{
+		{ID: uuid.New(), Details: &struct{ Name string }{"ann"}},
+		{ID: uuid.New()},
+		{ID: uuid.New()},
+	}
+
+	_, cursor, err := Paginate(list, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cursor == nil {
+		t.Fatal("page ending with a missing value must have a cursor")
+	}
+
+	next, err := ParseList(url.Values{"sort": {"nickname"}, "cursor": {*cursor}}, testListSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !next.afterNull || next.after[1] != items[1].ID.String() {
+		t.Fatalf("cursor must hold the missing value and the key, got %v %v", next.afterNull, next.after)
+	}
+
+	// cursors with missing values are only valid for nullable fields
+	if _, err := ParseList(url.Values{"sort": {"name"}, "cursor": {*cursor}}, testListSpec); err == nil {
+		t.Fatal("cursor of another order must be rejected")
+	}
+}
+
+func TestListScopeNullableField(t *testing.T) {
+	db := newDryRunDB(t)
+
+	id := uuid.New()
+	present := "ann"
+
+	cases := []struct {
+		sort  string
+		value *string
+		want  []string
+	}{
+		{"nickname", &present, []string{
+			"verified = true AND ((nickname, id) > ('ann', '" + id.String() + "') OR nickname IS NULL)",
+			"ORDER BY nickname ASC NULLS LAST,id ASC",
+		}},
+		{"nickname", nil, []string{
+			"verified = true AND (nickname IS NULL AND id > '" + id.String() + "')",
+		}},
+		{"-nickname", &present, []string{
+			"verified = true AND (nickname, id) < ('ann', '" + id.String() + "')",
+			"ORDER BY nickname DESC NULLS FIRST,id DESC",
+		}},
+		{"-nickname", nil, []string{
+			"verified = true AND (nickname IS NOT NULL OR id < '" + id.String() + "')",
+		}},
+	}
+
+	for _, c := range cases {
+		cursor, err := encodeCursor(c.sort, c.value, id.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		list, err := ParseList(url.Values{"sort": {c.sort}, "cursor": {cursor}, "verified": {"true"}}, testListSpec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sql := buildSQL(db, list.Scope)
+
+		for _, want := range c.want {
+			if !strings.Contains(sql, want) {
+				t.Errorf("unexpected statement for %s:\nactual: %s\nexpected to contain: %s\n", c.sort, sql, want)
+			}
+		}
+	}
+}
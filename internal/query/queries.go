@@ -1,14 +1,20 @@
 package query
 
 import (
+	"errors"
 	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+var ErrLastAdmin = errors.New("the last admin cannot lose admin permission")
+
 func ReadUserByID(db *gorm.DB, dest *models.User, id uuid.UUID) error {
-	return db.Where(&models.User{ID: id}).Joins("Details").First(dest).Error
+	return db.Where(&models.User{ID: id}).Joins("Details").Preload("Roles").First(dest).Error
 }
 
 func GetUserByID(db *gorm.DB, id uuid.UUID) (models.User, error) {
@@ -22,6 +28,25 @@ func GetUserByID(db *gorm.DB, id uuid.UUID) (models.User, error) {
 	return user, nil
 }
 
+// looks the user up by either email or username, emails
+// are compared case-insensitively
+func GetUserByLogin(db *gorm.DB, login string) (models.User, error) {
+	var user models.User
+
+	q := db.Where(&models.User{UserName: login})
+	if strings.Contains(login, "@") {
+		q = db.Where("lower(email) = ?", strings.ToLower(login))
+	}
+
+	q = q.Preload("Roles")
+
+	if err := q.First(&user).Error; err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
 func GetTokenByValue(db *gorm.DB, value string) (models.UserToken, error) {
 	var token models.UserToken
 
@@ -51,3 +76,228 @@ func GetDefaultAppStatus(db *gorm.DB) (models.DictAppStatus, error) {
 
 	return status, nil
 }
+
+// pushes token's expiration forward by ttl, but never beyond its creation
+// time plus maxAge; the update is skipped if the token was touched less
+// than interval ago, so active sessions don't write on every request
+func TouchToken(db *gorm.DB, token *models.UserToken, ttl, interval, maxAge time.Duration) error {
+	now := time.Now()
+
+	if now.Sub(token.LastUsedAt) < interval {
+		return nil
+	}
+
+	expiresAt := now.Add(ttl)
+	if deadline := token.CreatedAt.Add(maxAge); expiresAt.After(deadline) {
+		expiresAt = deadline
+	}
+
+	updates := models.UserToken{LastUsedAt: now, ExpiresAt: expiresAt}
+	if err := db.Model(token).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	token.LastUsedAt = now
+	token.ExpiresAt = expiresAt
+
+	return nil
+}
+
+// revokes every refresh token of the family and deletes
+// access tokens which were issued alongside them
+func RevokeRefreshFamily(db *gorm.DB, familyID uuid.UUID) error {
+	accessTokens := db.
+		Model(&models.RefreshToken{}).
+		Select("access_token_id").
+		Where(&models.RefreshToken{FamilyID: familyID}).
+		Where("access_token_id IS NOT NULL")
+
+	if err := db.Where("id IN (?)", accessTokens).Delete(&models.UserToken{}).Error; err != nil {
+		return err
+	}
+
+	return db.
+		Model(&models.RefreshToken{}).
+		Where(&models.RefreshToken{FamilyID: familyID}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).
+		Error
+}
+
+// tells whether any enrollment order references the user
+func IsEnrolled(db *gorm.DB, userID uuid.UUID) (bool, error) {
+	var count int64
+
+	err := db.
+		Model(&models.Application{}).
+		Where(&models.Application{UserID: userID}).
+		Where("enrollment_order_id IS NOT NULL").
+		Count(&count).
+		Error
+
+	return count > 0, err
+}
+
+// reports whether the user has at least one guardian
+func HasGuardian(db *gorm.DB, userID uuid.UUID) (bool, error) {
+	var count int64
+
+	err := db.
+		Model(&models.Guardian{}).
+		Where(&models.Guardian{UserID: userID}).
+		Count(&count).
+		Error
+
+	return count > 0, err
+}
+
+// reports whether the user has finished 2FA enrollment
+func HasTwoFactor(db *gorm.DB, userID uuid.UUID) (bool, error) {
+	var count int64
+
+	err := db.
+		Model(&models.UserTOTP{}).
+		Where(&models.UserTOTP{UserID: userID}).
+		Where("confirmed_at IS NOT NULL").
+		Count(&count).
+		Error
+
+	return count > 0, err
+}
+
+// counts users having admin permission either directly or through
+// a role, not taking into account the excluded user
+func CountAdminsExcept(db *gorm.DB, excluded uuid.UUID) (int64, error) {
+	var count int64
+
+	err := db.
+		Model(&models.User{}).
+		Joins("LEFT JOIN user_roles ON user_roles.user_id = users.id").
+		Joins("LEFT JOIN roles ON roles.id = user_roles.role_id").
+		Where("users.id <> ?", excluded).
+		Where("(users.permissions & ? <> 0 OR roles.permissions & ? <> 0)", permissions.PermissionAdmin, permissions.PermissionAdmin).
+		Distinct("users.id").
+		Count(&count).
+		Error
+
+	return count, err
+}
+
+// makes sure the change of user's effective permissions doesn't leave
+// the system without admins; must be called within a transaction,
+// concurrent changes are serialized with an advisory lock
+func EnsureAdminRemains(tx *gorm.DB, user models.User, newEffective int64) error {
+	if !permissions.HasAdmin(user.EffectivePermissions()) || permissions.HasAdmin(newEffective) {
+		return nil
+	}
+
+	if err := lockAdmins(tx); err != nil {
+		return err
+	}
+
+	count, err := CountAdminsExcept(tx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+func lockAdmins(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext('admins'))").Error
+}
+
+// ids of the users holding the role
+func GetRoleUserIDs(db *gorm.DB, roleID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+
+	if err := db.Table("user_roles").Where("role_id = ?", roleID).Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// saves role's new permissions making sure the system isn't left
+// without admins; must be called within a transaction
+func SaveRolePermissions(tx *gorm.DB, role models.Role, newPermissions int64) error {
+	losesAdmin := permissions.HasAdmin(role.Permissions) && !permissions.HasAdmin(newPermissions)
+
+	if losesAdmin {
+		if err := lockAdmins(tx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(&role).UpdateColumn("permissions", newPermissions).Error; err != nil {
+		return err
+	}
+
+	if !losesAdmin {
+		return nil
+	}
+
+	count, err := CountAdminsExcept(tx, uuid.Nil)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrLastAdmin
+	}
+
+	return nil
+}
+
+// returns majors the staff member is limited to,
+// empty result means there are no limitations
+func GetStaffScopeMajorIDs(db *gorm.DB, staffID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+
+	err := db.
+		Model(&models.StaffScope{}).
+		Where(&models.StaffScope{UserID: staffID}).
+		Pluck("major_id", &ids).
+		Error
+
+	return ids, err
+}
+
+// reports whether the target user has applied to at least one of the
+// majors the staff member is limited to; with allowUnapplied users who
+// haven't applied anywhere yet are within the scope as well
+func IsWithinStaffScope(db *gorm.DB, staffID uuid.UUID, targetID uuid.UUID, allowUnapplied bool) (bool, error) {
+	majors, err := GetStaffScopeMajorIDs(db, staffID)
+	if err != nil {
+		return false, err
+	}
+
+	if len(majors) == 0 {
+		return true, nil
+	}
+
+	var count int64
+
+	err = staffScopeQuery(db, targetID, majors, allowUnapplied).Count(&count).Error
+
+	return count > 0, err
+}
+
+func staffScopeQuery(db *gorm.DB, targetID uuid.UUID, majors []uuid.UUID, allowUnapplied bool) *gorm.DB {
+	sub := db.Session(&gorm.Session{NewDB: true})
+
+	applied := sub.Model(&models.Application{}).Select("1").Where("applications.user_id = users.id AND applications.major_id IN ?", majors)
+	q := db.Model(&models.User{}).Where("users.id = ?", targetID)
+
+	if !allowUnapplied {
+		return q.Where("EXISTS (?)", applied)
+	}
+
+	anyApplied := sub.Model(&models.Application{}).Select("1").Where("applications.user_id = users.id")
+
+	return q.Where("EXISTS (?) OR NOT EXISTS (?)", applied, anyApplied)
+}
@@ -0,0 +1,41 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStaffScopeQuery(t *testing.T) {
+	db := newDryRunDB(t)
+
+	targetID := uuid.New()
+	majorID := uuid.New()
+
+	inScope := "EXISTS (SELECT 1 FROM \"applications\" WHERE applications.user_id = users.id AND applications.major_id IN ('" + majorID.String() + "'))"
+	unapplied := "NOT EXISTS (SELECT 1 FROM \"applications\" WHERE applications.user_id = users.id)"
+
+	build := func(allowUnapplied bool) string {
+		var count int64
+		stmt := staffScopeQuery(db, targetID, []uuid.UUID{majorID}, allowUnapplied).Count(&count).Statement
+		return db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+	}
+
+	sql := build(false)
+
+	if !strings.Contains(sql, "users.id = '"+targetID.String()+"' AND "+inScope) {
+		t.Errorf("target must have applied to one of the majors:\n%s", sql)
+	}
+
+	if strings.Contains(sql, "NOT EXISTS") {
+		t.Errorf("applicants who haven't applied must be out of the scope by default:\n%s", sql)
+	}
+
+	// staff filing the first application of an applicant
+	sql = build(true)
+
+	if !strings.Contains(sql, "users.id = '"+targetID.String()+"' AND ("+inScope+" OR "+unapplied+")") {
+		t.Errorf("applicants who haven't applied anywhere must be within the scope:\n%s", sql)
+	}
+}
@@ -0,0 +1,83 @@
+package query
+
+import (
+	"imi/college/internal/models"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// columns searched through by the words of the query
+var userSearchColumns = []string{
+	"users.email",
+	"users.user_name",
+	`"Details".first_name`,
+	`"Details".middle_name`,
+	`"Details".last_name`,
+	`"Details".tel`,
+	`"Details".snils`,
+}
+
+// conditions of the user search which don't fit into list filters
+type UserSearch struct {
+	// every word has to be found in at least one of the searched columns
+	Query    string
+	MajorID  *uuid.UUID
+	StatusID *int
+	RegionID *int
+	// majors the staff member is limited to, empty means no limitation
+	ScopeMajorIDs []uuid.UUID
+}
+
+// escapes wildcards, so the value matches literally in LIKE patterns
+func EscapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// GORM scope of users matching the search, the query
+// must join users' details as "Details"
+func (s UserSearch) Scope(db *gorm.DB) *gorm.DB {
+	sub := db.Session(&gorm.Session{NewDB: true})
+
+	for _, word := range strings.Fields(s.Query) {
+		pattern := "%" + EscapeLike(word) + "%"
+
+		conditions := make([]string, 0, len(userSearchColumns))
+		args := make([]any, 0, len(userSearchColumns))
+
+		for _, column := range userSearchColumns {
+			conditions = append(conditions, column+" ILIKE ?")
+			args = append(args, pattern)
+		}
+
+		db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+
+	// major and status must belong to the same application
+	if s.MajorID != nil || s.StatusID != nil {
+		apps := sub.Model(&models.Application{}).Select("1").Where("applications.user_id = users.id")
+
+		if s.MajorID != nil {
+			apps = apps.Where("applications.major_id = ?", *s.MajorID)
+		}
+
+		if s.StatusID != nil {
+			apps = apps.Where("applications.status_id = ?", *s.StatusID)
+		}
+
+		db = db.Where("EXISTS (?)", apps)
+	}
+
+	if len(s.ScopeMajorIDs) > 0 {
+		apps := sub.Model(&models.Application{}).Select("1").Where("applications.user_id = users.id AND applications.major_id IN ?", s.ScopeMajorIDs)
+		db = db.Where("EXISTS (?)", apps)
+	}
+
+	if s.RegionID != nil {
+		addresses := sub.Model(&models.UserAddress{}).Select("1").Where("user_addresses.user_id = users.id AND user_addresses.region_id = ?", *s.RegionID)
+		db = db.Where("EXISTS (?)", addresses)
+	}
+
+	return db
+}
@@ -0,0 +1,139 @@
+package query
+
+import (
+	"imi/college/internal/models"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func buildUserSearchSQL(db *gorm.DB, scopes ...func(*gorm.DB) *gorm.DB) string {
+	var users []models.User
+
+	stmt := db.Model(&models.User{}).Joins("Details").Scopes(scopes...).Find(&users).Statement
+
+	return db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+}
+
+func TestUserSearchWords(t *testing.T) {
+	db := newDryRunDB(t)
+
+	sql := buildUserSearchSQL(db, UserSearch{Query: "  Ivan   100%_off "}.Scope)
+
+	// every word is looked for in every column
+	for _, column := range userSearchColumns {
+		for _, pattern := range []string{`'%Ivan%'`, `'%100\%\_off%'`} {
+			if want := column + " ILIKE " + pattern; !strings.Contains(sql, want) {
+				t.Errorf("unexpected statement:\nactual: %s\nexpected to contain: %s\n", sql, want)
+			}
+		}
+	}
+
+	// but has to be found in one of them only
+	if want := `(users.email ILIKE '%Ivan%' OR users.user_name ILIKE '%Ivan%' OR`; !strings.Contains(sql, want) {
+		t.Errorf("columns must be matched alternatively:\nactual: %s\nexpected to contain: %s\n", sql, want)
+	}
+
+	if want := `"Details".snils ILIKE '%Ivan%')) AND ((users.email ILIKE '%100\%\_off%'`; !strings.Contains(sql, want) {
+		t.Errorf("all words must be matched:\nactual: %s\nexpected to contain: %s\n", sql, want)
+	}
+}
+
+func TestUserSearchEmptyQuery(t *testing.T) {
+	db := newDryRunDB(t)
+
+	sql := buildUserSearchSQL(db, UserSearch{Query: "   "}.Scope)
+
+	if strings.Contains(sql, "ILIKE") || strings.Contains(sql, "EXISTS") {
+		t.Errorf("empty search must not filter users:\n%s", sql)
+	}
+}
+
+func TestUserSearchFilters(t *testing.T) {
+	db := newDryRunDB(t)
+
+	majorID := uuid.New()
+	scopeMajorID := uuid.New()
+	statusID := 3
+	regionID := 77
+
+	cases := []struct {
+		name   string
+		search UserSearch
+		want   []string
+	}{
+		{"major", UserSearch{MajorID: &majorID}, []string{
+			"EXISTS (SELECT 1 FROM \"applications\" WHERE applications.user_id = users.id AND applications.major_id = '" + majorID.String() + "'",
+		}},
+		{"status", UserSearch{StatusID: &statusID}, []string{
+			"EXISTS (SELECT 1 FROM \"applications\" WHERE applications.user_id = users.id AND applications.status_id = 3",
+		}},
+		// major and status of the same application
+		{"major and status", UserSearch{MajorID: &majorID, StatusID: &statusID}, []string{
+			"applications.major_id = '" + majorID.String() + "' AND applications.status_id = 3",
+		}},
+		{"region", UserSearch{RegionID: &regionID}, []string{
+			"EXISTS (SELECT 1 FROM \"user_addresses\" WHERE user_addresses.user_id = users.id AND user_addresses.region_id = 77",
+		}},
+		{"staff scope", UserSearch{ScopeMajorIDs: []uuid.UUID{scopeMajorID}}, []string{
+			"applications.user_id = users.id AND applications.major_id IN ('" + scopeMajorID.String() + "')",
+		}},
+		// the scope is checked separately, the searched major may be outside of it
+		{"major within staff scope", UserSearch{MajorID: &majorID, ScopeMajorIDs: []uuid.UUID{scopeMajorID}}, []string{
+			"applications.major_id = '" + majorID.String() + "'",
+			"applications.major_id IN ('" + scopeMajorID.String() + "')",
+		}},
+		{"words and region", UserSearch{Query: "petrov", RegionID: &regionID}, []string{
+			`"Details".last_name ILIKE '%petrov%'`,
+			"user_addresses.region_id = 77",
+		}},
+	}
+
+	for _, c := range cases {
+		sql := buildUserSearchSQL(db, c.search.Scope)
+
+		for _, want := range c.want {
+			if !strings.Contains(sql, want) {
+				t.Errorf("unexpected statement for %s:\nactual: %s\nexpected to contain: %s\n", c.name, sql, want)
+			}
+		}
+	}
+
+	// separate conditions must not be joined into the same subquery
+	sql := buildUserSearchSQL(db, UserSearch{MajorID: &majorID, ScopeMajorIDs: []uuid.UUID{scopeMajorID}}.Scope)
+	if count := strings.Count(sql, "EXISTS"); count != 2 {
+		t.Errorf("searched major and staff scope must be separate subqueries, got %d:\n%s", count, sql)
+	}
+}
+
+func TestUserSearchWithList(t *testing.T) {
+	db := newDryRunDB(t)
+
+	spec := ListSpec{
+		Sort:        map[string]SortField{"createdAt": {Column: "users.created_at", Field: "CreatedAt"}},
+		DefaultSort: "createdAt",
+		Key:         SortField{Column: "users.id", Field: "ID"},
+		Filters: map[string]Filter{
+			"verified": {Column: "users.is_verified", Parse: ParseBool},
+		},
+		DefaultLimit: 50,
+		MaxLimit:     200,
+	}
+
+	list, err := ParseList(url.Values{"verified": {"false"}}, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regionID := 5
+	sql := buildUserSearchSQL(db, UserSearch{Query: "anna", RegionID: &regionID}.Scope, list.Scope)
+
+	for _, want := range []string{`ILIKE '%anna%'`, "user_addresses.region_id = 5", "users.is_verified = false", "ORDER BY users.created_at ASC"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("search and list filters must be combined:\nactual: %s\nexpected to contain: %s\n", sql, want)
+		}
+	}
+}
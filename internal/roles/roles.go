@@ -0,0 +1,41 @@
+package roles
+
+import (
+	"imi/college/internal/models"
+	"imi/college/internal/permissions"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// creates built-in roles which are missing, roles which already
+// exist are left as is, since admins may have changed them
+func EnsureDefaults(db *gorm.DB) error {
+	for _, template := range permissions.DefaultRoles {
+		role := models.Role{
+			Name:        template.Name,
+			DisplayName: template.DisplayName,
+			Permissions: template.Permissions,
+			IsSystem:    true,
+		}
+
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoNothing: true,
+		}).Create(&role).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func GetByNames(db *gorm.DB, names []string) ([]models.Role, error) {
+	var roles []models.Role
+
+	if err := db.Where("name IN ?", names).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,213 @@
+package sessions
+
+import (
+	"errors"
+	"imi/college/internal/env"
+	"imi/college/internal/jwt"
+	"imi/college/internal/models"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// issues and verifies signed access tokens
+type Signer struct {
+	keys    *jwt.KeyRing
+	revoked *jwt.RevocationList
+	ttl     time.Duration
+}
+
+// returns nil if the server is configured to use opaque tokens
+func NewSignerFromEnv(db *gorm.DB) (*Signer, error) {
+	if !env.SignedTokens() {
+		return nil, nil
+	}
+
+	keys, err := jwt.ParseKeyRing(env.TokenSigningKeys())
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &Signer{
+		keys:    keys,
+		revoked: jwt.NewRevocationList(),
+		ttl:     env.SignedTokenTTL(),
+	}
+
+	if err := signer.Sync(db); err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
+
+func (s *Signer) TTL() time.Duration {
+	return s.ttl
+}
+
+// issues a token shaped like an opaque one, so clients don't
+// have to care about which mode the server runs in
+func (s *Signer) Issue(user models.User, familyID uuid.UUID) (models.UserToken, error) {
+	claims := jwt.Claims{}
+
+	if familyID != uuid.Nil {
+		claims.Family = familyID.String()
+	}
+
+	return s.issue(user, claims, s.ttl)
+}
+
+// issues a token letting the staff member act on behalf of the user
+func (s *Signer) IssueImpersonation(user models.User, impersonatorID uuid.UUID, ttl time.Duration) (models.UserToken, error) {
+	token, err := s.issue(user, jwt.Claims{Actor: impersonatorID.String()}, ttl)
+	if err != nil {
+		return models.UserToken{}, err
+	}
+
+	token.ImpersonatorID = &impersonatorID
+
+	return token, nil
+}
+
+func (s *Signer) issue(user models.User, claims jwt.Claims, ttl time.Duration) (models.UserToken, error) {
+	now := time.Now()
+	id := uuid.New()
+
+	claims.ID = id.String()
+	claims.Subject = user.ID.String()
+	claims.Permissions = user.EffectivePermissions()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return models.UserToken{}, err
+	}
+
+	return models.UserToken{
+		ID:         id,
+		UserID:     user.ID,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  time.Unix(claims.ExpiresAt, 0),
+		Token:      token,
+	}, nil
+}
+
+// restores the user from the token without touching the database,
+// the returned user only has ID and permissions filled in
+func (s *Signer) Verify(raw string) (models.User, jwt.Claims, error) {
+	claims, err := s.keys.Verify(raw, time.Now())
+	if err != nil {
+		return models.User{}, jwt.Claims{}, err
+	}
+
+	if s.revoked.Contains(claims.ID) || (len(claims.Family) > 0 && s.revoked.Contains(claims.Family)) ||
+		s.revoked.ContainsSubject(claims.Subject, claims.IssuedAt) {
+		return models.User{}, jwt.Claims{}, ErrTokenRevoked
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return models.User{}, jwt.Claims{}, jwt.ErrMalformed
+	}
+
+	return models.User{ID: id, Permissions: claims.Permissions}, claims, nil
+}
+
+// revokes a token or a whole refresh family by its id, the entry
+// is kept until expiresAt after which the tokens are expired anyway
+func (s *Signer) Revoke(db *gorm.DB, id string, expiresAt time.Time) error {
+	entry := models.RevokedToken{ID: id, ExpiresAt: expiresAt}
+
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+		return err
+	}
+
+	s.revoked.Add(id, expiresAt)
+
+	return nil
+}
+
+// revokes every token issued to the users so far, since tokens carry
+// permissions they have to be reissued once the permissions change;
+// the users keep their refresh tokens and get fresh access tokens
+// through them
+func (s *Signer) RevokeUsers(db *gorm.DB, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	// impersonation tokens may live longer than regular ones
+	expiresAt := now.Add(max(s.ttl, env.ImpersonationTTL()))
+
+	entries := make([]models.RevokedToken, 0, len(userIDs))
+	for _, id := range userIDs {
+		entries = append(entries, models.RevokedToken{ID: id.String(), ExpiresAt: expiresAt, IssuedBefore: &now})
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at", "issued_before"}),
+	}).Create(&entries).Error; err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		s.revoked.AddSubject(entry.ID, jwt.SubjectRevocation{IssuedBefore: now, ExpiresAt: expiresAt})
+	}
+
+	return nil
+}
+
+// loads revocations made by other replicas and
+// removes the ones which are no longer needed
+func (s *Signer) Sync(db *gorm.DB) error {
+	now := time.Now()
+
+	if err := db.Where("expires_at <= ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	var entries []models.RevokedToken
+
+	if err := db.Find(&entries).Error; err != nil {
+		return err
+	}
+
+	ids := make(map[string]time.Time, len(entries))
+	subjects := make(map[string]jwt.SubjectRevocation)
+
+	for _, entry := range entries {
+		if entry.IssuedBefore != nil {
+			subjects[entry.ID] = jwt.SubjectRevocation{IssuedBefore: *entry.IssuedBefore, ExpiresAt: entry.ExpiresAt}
+			continue
+		}
+
+		ids[entry.ID] = entry.ExpiresAt
+	}
+
+	s.revoked.Merge(ids, subjects, now)
+
+	return nil
+}
+
+// periodically syncs revocations in the background
+func (s *Signer) Watch(db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := s.Sync(db); err != nil {
+				slog.Error("Couldn't sync revoked tokens", "err", err.Error())
+			}
+		}
+	}()
+}
@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 variant; 6 digit codes
+// are the last 6 digits of the 8 digit ones from the RFC
+func TestCodeMatchesRFCVectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, expected := range vectors {
+		actual, err := Code(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual != expected {
+			t.Fatalf("code for %d doesn't match:\nactual: %s\nexpected: %s\n", unix, actual, expected)
+		}
+	}
+}
+
+func TestValidateToleratesSkew(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	previous, err := Code(secret, now.Add(-Period))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(secret, previous, now, 1)
+	if !ok {
+		t.Fatal("code of the previous step must be accepted with skew of 1")
+	}
+
+	if step != Step(now)-1 {
+		t.Fatal("matched step must be the previous one")
+	}
+
+	if _, ok := Validate(secret, previous, now, 0); ok {
+		t.Fatal("code of the previous step must be refused without skew")
+	}
+}
+
+func TestRecoveryCodeHashIgnoresFormatting(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if HashRecoveryCode(code) != HashRecoveryCode(" "+strings.ToUpper(code)+" ") {
+		t.Fatal("hash must not depend on case and surrounding spaces")
+	}
+}
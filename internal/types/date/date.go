@@ -58,3 +58,15 @@ func (date *Date) UnmarshalJSON(data []byte) error {
 	return nil
 
 }
+
+// full years passed since the date by the moment of now
+func (date Date) Age(now time.Time) int {
+	born := time.Time(date)
+	years := now.Year() - born.Year()
+
+	if now.Month() < born.Month() || (now.Month() == born.Month() && now.Day() < born.Day()) {
+		years--
+	}
+
+	return years
+}
@@ -76,3 +76,31 @@ func TestCustomDateFromJson(t *testing.T) {
 		t.Fatal("parse day doesn't match")
 	}
 }
+
+func TestAge(t *testing.T) {
+	birthday, err := time.Parse(time.DateOnly, "2008-03-15")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		now  string
+		want int
+	}{
+		{"2026-03-14", 17},
+		{"2026-03-15", 18},
+		{"2026-12-01", 18},
+		{"2026-01-20", 17},
+	}
+
+	for _, c := range cases {
+		now, err := time.Parse(time.DateOnly, c.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if age := Date(birthday).Age(now); age != c.want {
+			t.Fatalf("age on %s must be %d, got %d", c.now, c.want, age)
+		}
+	}
+}
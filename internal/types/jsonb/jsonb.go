@@ -0,0 +1,51 @@
+package jsonb
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// raw JSON stored in a jsonb column and passed to clients as is
+type JSON json.RawMessage
+
+func (j *JSON) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append(JSON{}, data...)
+	case string:
+		*j = JSON(data)
+	default:
+		return errors.New("JSON.Scan: unsupported type")
+	}
+
+	return nil
+}
+
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+
+	return string(j), nil
+}
+
+// GormDataType gorm common data type
+func (j JSON) GormDataType() string {
+	return "jsonb"
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+
+	return j, nil
+}
+
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append(JSON{}, data...)
+	return nil
+}
@@ -0,0 +1,20 @@
+package uploads
+
+import (
+	"os"
+	"path"
+
+	"github.com/google/uuid"
+)
+
+// directory holding files uploaded by users, one subdirectory per user
+const BaseDir = ".file-uploads"
+
+func UserDir(userID uuid.UUID) string {
+	return path.Join(BaseDir, userID.String())
+}
+
+// removes every file uploaded by the user
+func RemoveUser(userID uuid.UUID) error {
+	return os.RemoveAll(UserDir(userID))
+}
@@ -2,6 +2,7 @@ package validation
 
 import (
 	"slices"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -32,3 +33,9 @@ func ValidateUsername(fl validator.FieldLevel) bool {
 
 	return true
 }
+
+// emails are stored and compared in lower case, so the same
+// address typed with different case is treated as one
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
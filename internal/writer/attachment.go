@@ -0,0 +1,12 @@
+package writer
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// makes clients save the response body as a file
+func SetAttachment(w http.ResponseWriter, contentType string, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+}
@@ -0,0 +1,24 @@
+package writer
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+)
+
+// same as JSON, but compressed with gzip, the caller
+// has to make sure the client accepts it
+func GzipJSON(w http.ResponseWriter, status int, data any) error {
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(status)
+
+	gz := gzip.NewWriter(w)
+
+	if err := json.NewEncoder(gz).Encode(data); err != nil {
+		gz.Close()
+		return err
+	}
+
+	return gz.Close()
+}
@@ -0,0 +1,18 @@
+package writer
+
+import "net/http"
+
+// envelope of every paginated list
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// null when there are no more items
+	NextCursor *string `json:"nextCursor"`
+}
+
+func Paginated[T any](w http.ResponseWriter, status int, items []T, nextCursor *string) error {
+	if items == nil {
+		items = []T{}
+	}
+
+	return JSON(w, status, Page[T]{Items: items, NextCursor: nextCursor})
+}